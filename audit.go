@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxAuditResult bounds how much of a tool result is kept in the audit log
+const maxAuditResult = 4000
+
+// AuditEntry is one tool invocation in the audit log
+type AuditEntry struct {
+	Time   string                 `json:"time"`
+	Tool   string                 `json:"tool"`
+	Input  map[string]interface{} `json:"input"`
+	Result string                 `json:"result,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// auditLog appends tool invocations as JSON lines to a file
+type auditLog struct {
+	path string
+}
+
+// DefaultAuditFile returns the default audit log location
+func DefaultAuditFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".halu", "audit.log")
+}
+
+// record appends an entry. The file is opened for every entry so the log is
+// complete even if halu is killed.
+func (l *auditLog) record(tool string, input map[string]interface{}, result string, toolErr error) error {
+	entry := AuditEntry{
+		Time:   time.Now().Format(time.RFC3339),
+		Tool:   tool,
+		Input:  input,
+		Result: result,
+	}
+	if len(entry.Result) > maxAuditResult {
+		entry.Result = entry.Result[:maxAuditResult] + "... [truncated]"
+	}
+	if toolErr != nil {
+		entry.Error = toolErr.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return fmt.Errorf("error creating audit log directory: %v", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"halu/glad"
+	"halu/glad/claude"
+	"halu/glad/qwen"
+)
+
+// slashCommand is a local command typed at the prompt. Commands never reach
+// the model unless they say so, e.g. /compact.
+type slashCommand struct {
+	Name        string
+	Args        string
+	Description string
+	Run         func(a *Agent, ctx context.Context, args string, messages []glad.Message) ([]glad.Message, TokenUsage, error)
+}
+
+// slashCommands returns the available commands sorted by name
+func slashCommands() []slashCommand {
+	commands := []slashCommand{
+		{
+			Name:        "help",
+			Description: "List the available commands",
+			Run: func(a *Agent, ctx context.Context, args string, messages []glad.Message) ([]glad.Message, TokenUsage, error) {
+				for _, cmd := range slashCommands() {
+					usage := "/" + cmd.Name
+					if cmd.Args != "" {
+						usage += " " + cmd.Args
+					}
+					stepColor.Printf("  %-16s", usage)
+					fmt.Println(cmd.Description)
+				}
+				return messages, TokenUsage{}, nil
+			},
+		},
+		{
+			Name:        "clear",
+			Description: "Start a new conversation",
+			Run: func(a *Agent, ctx context.Context, args string, messages []glad.Message) ([]glad.Message, TokenUsage, error) {
+				a.contextTokens = 0
+				stepColor.Println("➤ conversation cleared")
+				return nil, TokenUsage{}, nil
+			},
+		},
+		{
+			Name:        "tools",
+			Description: "List the tools available to the model",
+			Run: func(a *Agent, ctx context.Context, args string, messages []glad.Message) ([]glad.Message, TokenUsage, error) {
+				var names []string
+				for name := range a.tools {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					toolColor.Printf("  %s", name)
+					fmt.Printf(": %s\n", a.tools[name].Description)
+				}
+				return messages, TokenUsage{}, nil
+			},
+		},
+		{
+			Name:        "model",
+			Args:        "[name]",
+			Description: "Show or switch the model",
+			Run: func(a *Agent, ctx context.Context, args string, messages []glad.Message) ([]glad.Message, TokenUsage, error) {
+				if args != "" {
+					if err := a.setModel(args); err != nil {
+						return messages, TokenUsage{}, err
+					}
+				}
+				stepColor.Printf("➤ model: %s\n", a.model())
+				return messages, TokenUsage{}, nil
+			},
+		},
+		{
+			Name:        "compact",
+			Description: "Summarize the conversation to free up context",
+			Run: func(a *Agent, ctx context.Context, args string, messages []glad.Message) ([]glad.Message, TokenUsage, error) {
+				compacted, usage, err := a.Compact(ctx, messages)
+				if err != nil {
+					return messages, usage, err
+				}
+				stepColor.Printf("➤ compacted %d messages into %d\n", len(messages), len(compacted))
+				return compacted, usage, nil
+			},
+		},
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// runSlashCommand runs the command on the input line. handled is false if
+// the line doesn't start with a known command and should go to the model
+// instead, like a prompt starting with an absolute path such as /etc/hosts.
+func (a *Agent) runSlashCommand(ctx context.Context, line string, messages []glad.Message) ([]glad.Message, TokenUsage, bool, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "/") {
+		return messages, TokenUsage{}, false, nil
+	}
+
+	name, args, _ := strings.Cut(line[1:], " ")
+	for _, cmd := range slashCommands() {
+		if cmd.Name == name {
+			messages, usage, err := cmd.Run(a, ctx, strings.TrimSpace(args), messages)
+			return messages, usage, true, err
+		}
+	}
+	return messages, TokenUsage{}, false, nil
+}
+
+// model returns the name of the model in use
+func (a *Agent) model() string {
+	switch p := a.provider.(type) {
+	case *claude.LLM:
+		return p.Model
+	case *qwen.LLM:
+		return p.Model
+	}
+	return "unknown"
+}
+
+// setModel switches the model used for the following requests
+func (a *Agent) setModel(name string) error {
+	switch p := a.provider.(type) {
+	case *claude.LLM:
+		p.Model = name
+	case *qwen.LLM:
+		p.Model = name
+	default:
+		return fmt.Errorf("the provider doesn't support switching models")
+	}
+	return nil
+}
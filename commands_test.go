@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"halu/glad"
+)
+
+func TestRunSlashCommandDispatch(t *testing.T) {
+	a := &Agent{}
+	messages := []glad.Message{{Role: "user"}}
+	tests := []struct {
+		line    string
+		handled bool
+	}{
+		{"/clear", true},
+		{"  /clear  ", true},
+		{"/etc/hosts is wrong, fix the localhost entry", false},
+		{"/usr/local/bin/tool crashes on start", false},
+		{"/clearly not a command", false},
+		{"explain /clear", false},
+	}
+	for _, tt := range tests {
+		_, _, handled, err := a.runSlashCommand(context.Background(), tt.line, messages)
+		if handled != tt.handled {
+			t.Errorf("runSlashCommand(%q) handled = %v, want %v", tt.line, handled, tt.handled)
+		}
+		if err != nil {
+			t.Errorf("runSlashCommand(%q): %v", tt.line, err)
+		}
+	}
+}
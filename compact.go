@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"halu/glad"
+)
+
+// summaryPrefix marks the synthetic system message holding the summary of
+// compacted turns
+const summaryPrefix = "Summary of the earlier conversation:\n\n"
+
+const summarizePrompt = `You summarize conversations between a user and a coding assistant so the conversation can continue without the original messages. Keep the user's goals and instructions, decisions made, files and functions touched, tool results still relevant, and open problems. Be concise, use bullet points, and don't add commentary.`
+
+// maxSummarizedResult bounds how much of a tool result goes into the
+// transcript sent for summarization
+const maxSummarizedResult = 2000
+
+// ContextOptions controls when old turns are summarized
+type ContextOptions struct {
+	Window    int64   // context window of the model in tokens
+	Threshold float64 // fraction of the window that triggers compaction
+	KeepTurns int     // most recent turns kept verbatim
+}
+
+// needsCompaction reports whether the last request used enough of the
+// context window to summarize old turns
+func (a *Agent) needsCompaction() bool {
+	if a.context.Window <= 0 || a.context.Threshold <= 0 {
+		return false
+	}
+	return float64(a.contextTokens) >= a.context.Threshold*float64(a.context.Window)
+}
+
+// compactMessages replaces all but the last keepTurns turns, where a turn
+// starts with a user message, with a single summary message. System prompts
+// are kept as they are.
+func (a *Agent) compactMessages(ctx context.Context, messages []glad.Message, keepTurns int) ([]glad.Message, TokenUsage, error) {
+	// Find the first message of the turns to keep
+	keepFrom := len(messages)
+	turns := 0
+	for i := len(messages) - 1; i >= 0 && turns < keepTurns; i-- {
+		if messages[i].Role == "user" {
+			keepFrom = i
+			turns++
+		}
+	}
+
+	var system, old []glad.Message
+	for _, m := range messages[:keepFrom] {
+		if m.Role == "system" && !strings.HasPrefix(m.Text, summaryPrefix) {
+			system = append(system, m)
+		} else {
+			old = append(old, m)
+		}
+	}
+	if len(old) == 0 {
+		return messages, TokenUsage{}, nil
+	}
+
+	var summary strings.Builder
+	_, usage, err := a.provider.Complete(ctx, []glad.Message{
+		{Role: "system", Text: summarizePrompt},
+		{Role: "user", Text: transcript(old)},
+	}, nil, glad.Callbacks{
+		Text: func(text string) {
+			summary.WriteString(text)
+		},
+		Retry: a.output.Retry,
+	})
+	if err != nil {
+		return messages, TokenUsage(usage), fmt.Errorf("failed to summarize conversation: %v", err)
+	}
+
+	compacted := append(system, glad.Message{Role: "system", Text: summaryPrefix + strings.TrimSpace(summary.String())})
+	compacted = append(compacted, messages[keepFrom:]...)
+	return compacted, TokenUsage(usage), nil
+}
+
+// Compact summarizes the whole conversation, leaving only the system prompt
+// and the summary
+func (a *Agent) Compact(ctx context.Context, messages []glad.Message) ([]glad.Message, TokenUsage, error) {
+	compacted, usage, err := a.compactMessages(ctx, messages, 0)
+	if err == nil {
+		a.contextTokens = 0
+	}
+	return compacted, usage, err
+}
+
+// transcript renders messages as plain text for summarization
+func transcript(messages []glad.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			sb.WriteString(strings.TrimPrefix(m.Text, summaryPrefix) + "\n\n")
+		case "user":
+			sb.WriteString("User: " + m.Text + "\n\n")
+		case "assistant":
+			if m.Text != "" {
+				sb.WriteString("Assistant: " + m.Text + "\n\n")
+			}
+			for _, call := range m.ToolCalls {
+				args, _ := json.Marshal(call.Args)
+				sb.WriteString(fmt.Sprintf("Assistant called %s(%s)\n\n", call.Name, args))
+			}
+		case "tool":
+			for _, result := range m.ToolResults {
+				content := result.Content
+				if len(content) > maxSummarizedResult {
+					content = content[:maxSummarizedResult] + "... [truncated]"
+				}
+				sb.WriteString(fmt.Sprintf("%s returned: %s\n\n", result.Name, content))
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// completer completes slash commands at the start of the line and
+// filesystem paths relative to the cwd elsewhere. It implements
+// readline.AutoCompleter.
+type completer struct{}
+
+// Do returns the candidate suffixes for the text before the cursor, and
+// the length of the token they complete
+func (completer) Do(line []rune, pos int) ([][]rune, int) {
+	text := string(line[:pos])
+
+	if strings.HasPrefix(text, "/") && !strings.ContainsAny(text, " \t\n") {
+		prefix := text[1:]
+		var candidates [][]rune
+		for _, cmd := range slashCommands() {
+			if strings.HasPrefix(cmd.Name, prefix) {
+				candidates = append(candidates, []rune(cmd.Name[len(prefix):]+" "))
+			}
+		}
+		return candidates, len([]rune(prefix))
+	}
+
+	token := text[strings.LastIndexAny(text, " \t\n")+1:]
+	if !looksLikePath(token) {
+		return nil, 0
+	}
+	return completePath(token)
+}
+
+// looksLikePath reports whether a token is worth completing as a path
+func looksLikePath(token string) bool {
+	return strings.Contains(token, "/") || strings.HasPrefix(token, ".") || strings.HasPrefix(token, "~")
+}
+
+// completePath lists the entries of the token's directory starting with its
+// last path element. Directories complete with a trailing slash so
+// completion can continue into them.
+func completePath(token string) ([][]rune, int) {
+	dir, base := "", token
+	if i := strings.LastIndex(token, "/"); i >= 0 {
+		dir, base = token[:i+1], token[i+1:]
+	}
+
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	} else if strings.HasPrefix(readDir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = filepath.Join(home, readDir[2:])
+		}
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil, 0
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		// Hidden entries only when asked for
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		} else {
+			name += " "
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	candidates := make([][]rune, len(names))
+	for i, name := range names {
+		candidates[i] = []rune(name[len(base):])
+	}
+	return candidates, len([]rune(base))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// maxDiffCells bounds the size of the table used to diff two files. Larger
+// files are shown as replaced entirely.
+const maxDiffCells = 25_000_000
+
+// diffLine is one line of a line diff, Kind is ' ', '-' or '+'
+type diffLine struct {
+	Kind byte
+	Text string
+}
+
+// unifiedDiff returns a unified diff between two texts, or an empty string
+// if they are equal. It doesn't need git, see showDiff.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Walk the hunks, each a run of changes with context around it
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == ' ' {
+			i++
+			oldLine++
+			newLine++
+			continue
+		}
+
+		// Start the hunk with up to diffContext lines before the change
+		start := i
+		for start > 0 && i-start < diffContext && lines[start-1].Kind == ' ' {
+			start--
+		}
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+
+		// Extend it while the next change is within twice the context
+		end := i
+		for end < len(lines) {
+			if lines[end].Kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Kind == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				end = min(end+diffContext, next)
+				break
+			}
+			end = next
+		}
+
+		oldCount, newCount := 0, 0
+		for _, line := range lines[start:end] {
+			if line.Kind != '+' {
+				oldCount++
+			}
+			if line.Kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, line := range lines[start:end] {
+			fmt.Fprintf(&b, "%c%s\n", line.Kind, line.Text)
+		}
+
+		oldLine += oldCount - (i - start)
+		newLine += newCount - (i - start)
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the start and length of a hunk like diff -u does
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits text into lines without their newlines
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a line diff from the longest common subsequence of
+// both sides, after trimming the common prefix and suffix
+func diffLines(a, b []string) []diffLine {
+	var lines []diffLine
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		lines = append(lines, diffLine{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			lines = append(lines, diffLine{'-', line})
+		}
+		for _, line := range midB {
+			lines = append(lines, diffLine{'+', line})
+		}
+	} else {
+		// lcs[i][j] is the LCS length of midA[i:] and midB[j:]
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(midA) || j < len(midB) {
+			switch {
+			case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+				lines = append(lines, diffLine{' ', midA[i]})
+				i++
+				j++
+			case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+				lines = append(lines, diffLine{'-', midA[i]})
+				i++
+			default:
+				lines = append(lines, diffLine{'+', midB[j]})
+				j++
+			}
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	return lines
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives the file the owner of the original file it replaces.
+// Only root may give files away, so failures are ignored and the file stays
+// owned by the user running halu.
+func preserveOwner(path string, original os.FileInfo) {
+	stat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok || (int(stat.Uid) == os.Getuid() && int(stat.Gid) == os.Getgid()) {
+		return
+	}
+	_ = os.Chown(path, int(stat.Uid), int(stat.Gid))
+}
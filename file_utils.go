@@ -2,19 +2,117 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"golang.org/x/term"
 )
 
+// stdinIsTerminal reports whether the user can be asked for confirmation
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// confirm asks the user a yes/no question, defaulting to yes. Without a
+// terminal to ask on the answer is no. Questions go to stderr, which stays
+// the terminal when stdout carries results.
+func confirm(question string) bool {
+	if !stdinIsTerminal() {
+		errorColor.Fprintf(os.Stderr, "\n%s no, stdin is not a terminal\n", question)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "\n%s [Y/n]: ", question)
+	reader := bufio.NewReader(os.Stdin)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// diffCommand is the viewer used to preview changes, from --diff or
+// HALU_DIFF: "git" (the default), "plain" for the builtin unified diff, or a
+// command like "delta" or "difft" that is passed the old and new file
+var diffCommand string
+
+// showDiff prints the changes between the original and proposed files of
+// path to w using the configured diff viewer. Without git the builtin
+// unified diff is used.
+func showDiff(w io.Writer, path, originalPath, proposedPath string) {
+	command := diffCommand
+	if command == "" || command == "git" {
+		if _, err := exec.LookPath("git"); err != nil {
+			command = "plain"
+		}
+	}
+
+	var cmd *exec.Cmd
+	switch command {
+	case "", "git":
+		cmd = exec.Command("git", "--no-pager", "diff", "--no-index", originalPath, proposedPath)
+	case "plain":
+		original, _ := os.ReadFile(originalPath)
+		proposed, _ := os.ReadFile(proposedPath)
+		for _, line := range strings.SplitAfter(unifiedDiff("a/"+path, "b/"+path, string(original), string(proposed)), "\n") {
+			switch {
+			case strings.HasPrefix(line, "@@"):
+				color.New(color.FgCyan).Fprint(w, line)
+			case strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++"):
+				color.New(color.FgGreen).Fprint(w, line)
+			case strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---"):
+				color.New(color.FgRed).Fprint(w, line)
+			default:
+				fmt.Fprint(w, line)
+			}
+		}
+		return
+	default:
+		args := strings.Fields(command)
+		cmd = exec.Command(args[0], append(args[1:], originalPath, proposedPath)...)
+	}
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Diff tools exit with 1 when the files differ
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			errorColor.Fprintf(w, "failed to run diff viewer %q: %v\n", command, err)
+		}
+	}
+}
+
+// errChangeRejected is returned by writeWithConfirmation when the user skips
+// a change. Tools report it to the model rather than failing.
+var errChangeRejected = errors.New("change rejected by user")
+
+// writeOptions controls how writeWithConfirmation applies changes
+type writeOptions struct {
+	Yolo   bool // apply without confirmation
+	Backup bool // copy the original to a timestamped .bak file first
+	// Preview shows the changes between the original and proposed files of
+	// path, on stderr if nil
+	Preview func(path, originalPath, proposedPath string)
+}
+
 // writeWithConfirmation handles the common pattern of writing content to a file with diff preview
-// and user confirmation. If yolo is true, it writes directly without confirmation.
-func writeWithConfirmation(path string, content []byte, yolo bool) error {
+// and user confirmation. If opts.Yolo is true, it writes directly without confirmation.
+func writeWithConfirmation(path string, content []byte, opts writeOptions) error {
+
+	// Models write \n line endings, files written with \r\n keep theirs
+	if original, err := os.ReadFile(path); err == nil && usesCRLF(original) {
+		content = toCRLF(content)
+	}
 
-	// Create temp file with new content
-	tempFile, err := os.CreateTemp("", "ai-edit-*")
+	// Create temp file with new content, keeping the extension for editors
+	tempFile, err := os.CreateTemp("", "ai-edit-*"+filepath.Ext(path))
 	if err != nil {
 		return fmt.Errorf("error creating temp file: %v", err)
 	}
@@ -40,17 +138,59 @@ func writeWithConfirmation(path string, content []byte, yolo bool) error {
 	}
 
 	// Show diff and get confirmation
-	fmt.Println("\nShowing diff between original and proposed changes...")
-	cmd := exec.Command("git", "--no-pager", "diff", "--no-index", originalPath, tempFilePath)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Run()
+	preview := opts.Preview
+	if preview == nil {
+		preview = func(path, originalPath, proposedPath string) {
+			fmt.Fprintln(os.Stderr, "\nShowing diff between original and proposed changes...")
+			showDiff(os.Stderr, path, originalPath, proposedPath)
+		}
+	}
+	preview(path, originalPath, tempFilePath)
+
+	if !opts.Yolo {
+		// Reading the answer from piped input would consume it or block
+		if !stdinIsTerminal() {
+			errorColor.Fprintf(os.Stderr, "\nNot applying changes to %s, stdin is not a terminal to confirm them\n", path)
+			return fmt.Errorf("changes to %s not applied, they need confirmation but stdin is not a terminal (run with --yolo to apply changes without confirmation)", path)
+		}
 
-	if !yolo {
-		fmt.Print("\nPress Enter to apply changes, Ctrl+C to cancel: ")
+		// The user may edit the proposal until it's right, each edit shows
+		// the diff again
+		editor := os.Getenv("EDITOR")
+		question := "\nPress Enter to apply changes, n to skip them: "
+		if editor != "" {
+			question = "\nPress Enter to apply changes, e to edit them, n to skip them: "
+		}
 		reader := bufio.NewReader(os.Stdin)
-		reader.ReadString('\n')
+		for {
+			fmt.Fprint(os.Stderr, question)
+			answer, err := reader.ReadString('\n')
+			if err != nil {
+				// Without a reply, like on Ctrl-D, nothing is applied
+				return errChangeRejected
+			}
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer == "" || answer == "y" || answer == "yes" {
+				break
+			}
+			if answer == "n" || answer == "no" {
+				return errChangeRejected
+			}
+			if answer != "e" || editor == "" {
+				// Anything else, like a typo, asks again rather than applying
+				continue
+			}
+			if err := editFile(editor, tempFilePath); err != nil {
+				errorColor.Fprintf(os.Stderr, "Editing failed: %v\n", err)
+				continue
+			}
+			edited, err := os.ReadFile(tempFilePath)
+			if err != nil {
+				return fmt.Errorf("error reading edited file: %v", err)
+			}
+			content = edited
+			preview(path, originalPath, tempFilePath)
+		}
 	}
 
 	// Ensure directory exists before creating the destination file
@@ -59,22 +199,117 @@ func writeWithConfirmation(path string, content []byte, yolo bool) error {
 		return fmt.Errorf("error creating directory: %v", err)
 	}
 
-	// Apply changes by copying file contents
-	source, err := os.Open(tempFilePath)
+	if opts.Backup {
+		if err := backupFile(path); err != nil {
+			return err
+		}
+	}
+
+	return writeFileAtomic(path, content)
+}
+
+// editFile opens path in the editor, a command like "vim" or "code --wait",
+// and waits for it to exit. The editor draws on stderr, which stays the
+// terminal when stdout carries results.
+func editFile(editor, path string) error {
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// usesCRLF reports whether most lines of content end in \r\n
+func usesCRLF(content []byte) bool {
+	crlf := bytes.Count(content, []byte("\r\n"))
+	return crlf > 0 && crlf*2 > bytes.Count(content, []byte("\n"))
+}
+
+// toCRLF ends every line of content in \r\n, leaving lines that already do
+// alone
+func toCRLF(content []byte) []byte {
+	lf := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+}
+
+// backupFile copies an existing file to path.<timestamp>.bak, so every
+// version the agent replaces is kept
+func backupFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("error opening temp file: %v", err)
+		return fmt.Errorf("error reading file to back up: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading file to back up: %v", err)
+	}
+	backup := path + "." + time.Now().Format("20060102-150405") + ".bak"
+	if err := os.WriteFile(backup, content, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file with a temp file written next to it, so
+// a failed write never leaves the file truncated. Symlinks are followed so
+// the link stays in place. Existing files keep their mode and, where
+// permitted, their owner. New files get 0644.
+func writeFileAtomic(path string, content []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	mode := os.FileMode(0o644)
+	original, err := os.Stat(path)
+	if err == nil {
+		mode = original.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
 	}
-	defer source.Close()
 
-	dest, err := os.Create(path)
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".halu-*")
 	if err != nil {
-		return fmt.Errorf("error creating destination file: %v", err)
+		return fmt.Errorf("error creating temp file: %v", err)
 	}
-	defer dest.Close()
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath) // fails harmlessly once renamed
 
-	if _, err = io.Copy(dest, source); err != nil {
-		return fmt.Errorf("error copying file: %v", err)
+	if _, err := tempFile.Write(content); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("error writing temp file: %v", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("error syncing temp file: %v", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("error closing temp file: %v", err)
+	}
+	// chown clears setuid and setgid, so it goes first
+	if original != nil {
+		preserveOwner(tempPath, original)
+	}
+	if err := os.Chmod(tempPath, mode); err != nil {
+		return fmt.Errorf("error setting file mode: %v", err)
 	}
 
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("error replacing file: %v", err)
+	}
 	return nil
 }
+
+// isBinaryFile reports whether the file looks binary, i.e. contains a NUL
+// byte in its first 512 bytes
+func isBinaryFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := f.Read(buf)
+	return bytes.IndexByte(buf[:n], 0) != -1
+}
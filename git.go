@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// maxGitOutput bounds the output of git commands returned to the model
+const maxGitOutput = 50000
+
+// inGitRepo reports whether the cwd is inside a git work tree
+func inGitRepo() bool {
+	out, err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// runGit runs git in the cwd and returns its output, failing cleanly when
+// the cwd isn't a repository. Output past maxGitOutput is truncated.
+func runGit(args ...string) (string, error) {
+	if !inGitRepo() {
+		return "", fmt.Errorf("not a git repository, git tools only work inside one")
+	}
+
+	cmd := exec.Command("git", append([]string{"--no-pager"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v\n%s", args[0], err, output)
+	}
+
+	result := string(output)
+	if len(result) > maxGitOutput {
+		result = result[:maxGitOutput] + "\n... [output truncated]"
+	}
+	return result, nil
+}
@@ -0,0 +1,327 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"halu/glad"
+)
+
+// LLM talks to the Anthropic messages API
+type LLM struct {
+	Client    *anthropic.Client
+	Model     string
+	MaxTokens int64
+	// Temperature and TopP use the API defaults when nil
+	Temperature *float64
+	TopP        *float64
+	// ThinkingBudget enables extended thinking with this many tokens for
+	// reasoning before each reply, 0 to disable. The reply's own MaxTokens
+	// come on top.
+	ThinkingBudget int64
+	// CountTokens counts the input tokens of every request before sending
+	// it and reports them to the InputEstimate callback
+	CountTokens bool
+	// MaxToolRounds stops Complete with glad.ErrToolLimit once the model
+	// asks for tools more often than this, 0 for no limit
+	MaxToolRounds int
+}
+
+func NewLLM(client *anthropic.Client) *LLM {
+	return &LLM{
+		Client:    client,
+		Model:     "claude-3-7-sonnet-latest",
+		MaxTokens: 4096,
+	}
+}
+
+// ephemeral marks the end of a prompt prefix the API may cache
+var ephemeral = anthropic.F(anthropic.CacheControlEphemeralParam{
+	Type: anthropic.F(anthropic.CacheControlEphemeralTypeEphemeral),
+})
+
+// convertTools converts glad tools into Anthropic tool params. The tool
+// definitions are the same every turn, so they end with a cache breakpoint.
+func convertTools(tools []glad.Tool) []anthropic.ToolUnionUnionParam {
+	var converted []anthropic.ToolUnionUnionParam
+	for i, tool := range tools {
+		param := anthropic.ToolParam{
+			Name:        anthropic.F(tool.Name),
+			Description: anthropic.F(tool.Description),
+			InputSchema: anthropic.F(interface{}(tool.JSONSchema())),
+		}
+		if i == len(tools)-1 {
+			param.CacheControl = ephemeral
+		}
+		converted = append(converted, param)
+	}
+	return converted
+}
+
+// convertMessages converts the conversation into Anthropic message params.
+// System messages are returned separately since the API takes them as a
+// parameter rather than as part of the conversation, and end with a cache
+// breakpoint so they are cached along with the tools.
+func convertMessages(messages []glad.Message) ([]anthropic.TextBlockParam, []anthropic.MessageParam) {
+	var system []anthropic.TextBlockParam
+	var converted []anthropic.MessageParam
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			system = append(system, anthropic.NewTextBlock(m.Text))
+		case "user":
+			converted = append(converted, anthropic.NewUserMessage(anthropic.NewTextBlock(m.Text)))
+		case "assistant":
+			var blocks []anthropic.ContentBlockParamUnion
+			// Only signed reasoning is accepted back
+			if m.Thinking != "" && m.ThinkingSignature != "" {
+				blocks = append(blocks, anthropic.ThinkingBlockParam{
+					Type:      anthropic.F(anthropic.ThinkingBlockParamTypeThinking),
+					Thinking:  anthropic.F(m.Thinking),
+					Signature: anthropic.F(m.ThinkingSignature),
+				})
+			}
+			for _, data := range m.RedactedThinking {
+				blocks = append(blocks, anthropic.RedactedThinkingBlockParam{
+					Type: anthropic.F(anthropic.RedactedThinkingBlockParamTypeRedactedThinking),
+					Data: anthropic.F(data),
+				})
+			}
+			if m.Text != "" {
+				blocks = append(blocks, anthropic.NewTextBlock(m.Text))
+			}
+			for _, call := range m.ToolCalls {
+				blocks = append(blocks, anthropic.NewToolUseBlockParam(call.ID, call.Name, call.Args))
+			}
+			converted = append(converted, anthropic.NewAssistantMessage(blocks...))
+		case "tool":
+			var blocks []anthropic.ContentBlockParamUnion
+			for _, result := range m.ToolResults {
+				blocks = append(blocks, anthropic.NewToolResultBlock(result.ID, result.Content, false))
+			}
+			converted = append(converted, anthropic.NewUserMessage(blocks...))
+		}
+	}
+	if len(system) > 0 {
+		system[len(system)-1].CacheControl = ephemeral
+	}
+	return system, converted
+}
+
+// Complete implements glad.Provider
+func (l *LLM) Complete(ctx context.Context, messages []glad.Message, tools []glad.Tool, cb glad.Callbacks) ([]glad.Message, glad.Usage, error) {
+	var total glad.Usage
+	rounds := 0
+	for {
+		reply, usage, err := l.completeOnce(ctx, messages, tools, cb)
+		// Every request's reported usage is counted once
+		total.InputTokens += usage.InputTokens
+		total.OutputTokens += usage.OutputTokens
+		total.CacheCreationTokens += usage.CacheCreationTokens
+		total.CacheReadTokens += usage.CacheReadTokens
+		if err != nil {
+			return messages, total, err
+		}
+		messages = append(messages, reply)
+
+		if cb.Usage != nil {
+			cb.Usage(usage)
+		}
+
+		if len(reply.ToolCalls) == 0 {
+			return messages, total, nil
+		}
+
+		rounds++
+		if l.MaxToolRounds > 0 && rounds > l.MaxToolRounds {
+			messages = append(messages, glad.ToolLimitResults(reply.ToolCalls, l.MaxToolRounds))
+			return messages, total, glad.ErrToolLimit
+		}
+
+		results := glad.Message{Role: "tool"}
+		for _, call := range reply.ToolCalls {
+			results.ToolResults = append(results.ToolResults, glad.ToolResult{
+				ID:      call.ID,
+				Name:    call.Name,
+				Content: cb.Tool(call.Name, call.Args),
+			})
+		}
+		messages = append(messages, results)
+	}
+}
+
+// CountInputTokens implements glad.TokenCounter
+func (l *LLM) CountInputTokens(ctx context.Context, messages []glad.Message, tools []glad.Tool) (int64, error) {
+	system, params := convertMessages(messages)
+	return l.countTokens(ctx, anthropic.MessageNewParams{
+		Model:    anthropic.F(l.Model),
+		Messages: anthropic.F(params),
+	}, convertTools(tools), system)
+}
+
+// countTokens returns the number of input tokens the request will use
+func (l *LLM) countTokens(ctx context.Context, params anthropic.MessageNewParams, toolParams []anthropic.ToolUnionUnionParam, system []anthropic.TextBlockParam) (int64, error) {
+	// Convert tools to MessageCountTokensToolUnionParam type for token counting
+	var tokenCountToolParams []anthropic.MessageCountTokensToolUnionParam
+	for _, tool := range toolParams {
+		if tp, ok := tool.(anthropic.ToolParam); ok {
+			tokenCountToolParams = append(tokenCountToolParams, tp)
+		}
+	}
+
+	countParams := anthropic.MessageCountTokensParams{
+		Model:    params.Model,
+		Messages: params.Messages,
+		Tools:    anthropic.F(tokenCountToolParams),
+	}
+	if len(system) > 0 {
+		countParams.System = anthropic.F[anthropic.MessageCountTokensParamsSystemUnion](anthropic.MessageCountTokensParamsSystemArray(system))
+	}
+	tokensCountResult, err := l.Client.Messages.CountTokens(ctx, countParams)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count input tokens: %v", err)
+	}
+	return tokensCountResult.InputTokens, nil
+}
+
+// completeOnce streams a single assistant reply.
+//
+// The usage returned is what the API reported for the reply. Failed requests
+// report none, so nothing is counted for them.
+func (l *LLM) completeOnce(ctx context.Context, messages []glad.Message, tools []glad.Tool, cb glad.Callbacks) (glad.Message, glad.Usage, error) {
+
+	system, params := convertMessages(messages)
+	toolParams := convertTools(tools)
+
+	// Prepare parameters for streaming message
+	streamParams := anthropic.MessageNewParams{
+		Model:     anthropic.F(l.Model),
+		MaxTokens: anthropic.F(l.MaxTokens),
+		Messages:  anthropic.F(params),
+		Tools:     anthropic.F(toolParams),
+	}
+	if len(system) > 0 {
+		streamParams.System = anthropic.F(system)
+	}
+	if l.Temperature != nil {
+		streamParams.Temperature = anthropic.F(*l.Temperature)
+	}
+	if l.TopP != nil {
+		streamParams.TopP = anthropic.F(*l.TopP)
+	}
+	if l.ThinkingBudget > 0 {
+		streamParams.MaxTokens = anthropic.F(l.MaxTokens + l.ThinkingBudget)
+		streamParams.Thinking = anthropic.F[anthropic.ThinkingConfigParamUnion](anthropic.ThinkingConfigEnabledParam{
+			Type:         anthropic.F(anthropic.ThinkingConfigEnabledTypeEnabled),
+			BudgetTokens: anthropic.F(l.ThinkingBudget),
+		})
+	}
+
+	// Counting first costs a round trip, the reply reports the usage anyway
+	var estimate int64
+	if l.CountTokens {
+		var err error
+		estimate, err = l.countTokens(ctx, streamParams, toolParams, system)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		} else if cb.InputEstimate != nil {
+			cb.InputEstimate(estimate)
+		}
+	}
+
+	// Retry logic for streaming errors
+	maxRetries := 10
+	var message anthropic.Message
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		// Create the streaming message
+		stream := l.Client.Messages.NewStreaming(ctx, streamParams)
+		message = anthropic.Message{}
+
+		// Process the stream
+		for stream.Next() {
+			event := stream.Current()
+			// Accumulating keeps the usage of the message start and delta
+			// events, which is all the usage the request reports
+			message.Accumulate(event)
+
+			// Handle content blocks deltas for streaming output
+			if event.Type == anthropic.MessageStreamEventTypeContentBlockDelta {
+				delta := event.Delta.(anthropic.ContentBlockDeltaEventDelta)
+				if delta.Type == anthropic.ContentBlockDeltaEventDeltaTypeTextDelta && cb.Text != nil {
+					cb.Text(delta.Text)
+				}
+				if delta.Type == anthropic.ContentBlockDeltaEventDeltaTypeThinkingDelta && cb.Thinking != nil {
+					cb.Thinking(delta.Thinking)
+				}
+			}
+		}
+
+		// Check for errors
+		if err := stream.Err(); err != nil {
+			delay, retry := retryDelay(err, attempt)
+			err = classifyError(err)
+			if retry && attempt < maxRetries {
+				if cb.Retry != nil {
+					cb.Retry(attempt, maxRetries, delay, err)
+				}
+				if err := sleep(ctx, delay); err != nil {
+					return glad.Message{}, glad.Usage{}, err
+				}
+				continue // Retry
+			}
+
+			// If we've reached max retries or it's a permanent error, return the error
+			if !retry {
+				return glad.Message{}, glad.Usage{}, fmt.Errorf("streaming error, not retried: %w", err)
+			}
+			return glad.Message{}, glad.Usage{}, fmt.Errorf("streaming error after %d attempts: %w", attempt, err)
+		}
+
+		// If we got here, streaming completed successfully
+		break
+	}
+
+	// Once the prompt is cached, input tokens only count the uncached part.
+	// The estimate only stands in when the API reported no input at all.
+	usage := glad.Usage{
+		InputTokens:         message.Usage.InputTokens,
+		OutputTokens:        message.Usage.OutputTokens,
+		CacheCreationTokens: message.Usage.CacheCreationInputTokens,
+		CacheReadTokens:     message.Usage.CacheReadInputTokens,
+	}
+	if usage.InputTokens == 0 && usage.CacheCreationTokens == 0 && usage.CacheReadTokens == 0 {
+		usage.InputTokens = estimate
+	}
+
+	reply := glad.Message{Role: "assistant"}
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			reply.Text += block.Text
+		case "thinking":
+			reply.Thinking += block.Thinking
+			reply.ThinkingSignature = block.Signature
+		case "redacted_thinking":
+			reply.RedactedThinking = append(reply.RedactedThinking, block.Data)
+		case "tool_use":
+			var args map[string]any
+			if err := json.Unmarshal(block.Input, &args); err != nil {
+				return glad.Message{}, usage, fmt.Errorf("failed to parse tool input: %v", err)
+			}
+			if args == nil {
+				args = make(map[string]any)
+			}
+			reply.ToolCalls = append(reply.ToolCalls, glad.ToolCall{
+				ID:   block.ID,
+				Name: block.Name,
+				Args: args,
+			})
+		}
+	}
+
+	return reply, usage, nil
+}
@@ -0,0 +1,131 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const (
+	baseRetryDelay = time.Second
+	maxRetryDelay  = time.Minute
+)
+
+// Error types the API reports that are worth retrying, as opposed to ones
+// like authentication_error or invalid_request_error that fail again
+var transientErrorTypes = map[string]bool{
+	"overloaded_error": true,
+	"rate_limit_error": true,
+	"api_error":        true,
+	"timeout_error":    true,
+}
+
+// errorType returns the type of an API error, like overloaded_error, from
+// the body of a failed request or an error event received while streaming.
+// It returns "" for errors that don't carry one, such as network failures.
+func errorType(err error) string {
+	body := err.Error()
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		body = apiErr.JSON.RawJSON()
+	} else if i := strings.Index(body, "{"); i >= 0 {
+		body = body[i:]
+	} else {
+		return ""
+	}
+
+	var payload struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(body), &payload) != nil {
+		return ""
+	}
+	return payload.Error.Type
+}
+
+// classifyError names the kind of a failed request for the user, wrapping
+// err with its API error type when it has one
+func classifyError(err error) error {
+	if typ := errorType(err); typ != "" {
+		return fmt.Errorf("%s: %w", typ, err)
+	}
+	return err
+}
+
+// retryDelay decides whether a failed request should be retried and how long
+// to wait before the given attempt (starting at 1) is repeated. The error
+// type the API reports decides first, so an error event in a stream that
+// started fine is classified too. Otherwise client errors other than 429
+// are not retried. Rate limits and overloads honor Retry-After, everything
+// else backs off exponentially with jitter.
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+	if typ := errorType(err); typ != "" && !transientErrorTypes[typ] {
+		return 0, false
+	}
+
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		status := apiErr.StatusCode
+		if status >= 400 && status < 500 && status != http.StatusTooManyRequests && status != http.StatusRequestTimeout {
+			return 0, false
+		}
+		if apiErr.Response != nil {
+			if delay, ok := parseRetryAfter(apiErr.Response.Header.Get("Retry-After")); ok {
+				return delay, true
+			}
+		}
+	}
+
+	return backoff(attempt), true
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or
+// as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds*float64(time.Second)), maxRetryDelay), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return min(max(time.Until(date), 0), maxRetryDelay), true
+	}
+	return 0, false
+}
+
+// backoff returns an exponentially growing delay with jitter, so concurrent
+// clients don't retry in lockstep
+func backoff(attempt int) time.Duration {
+	delay := baseRetryDelay << min(attempt-1, 10)
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// sleep waits for the delay or until the context is done
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1,13 +1,47 @@
 package glad
 
-type Message interface{}
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Message is a provider independent conversation entry. Role is "system",
+// "user", "assistant" or "tool". Assistant messages may request ToolCalls,
+// which are answered by a following "tool" message carrying ToolResults.
+type Message struct {
+	Role        string
+	Text        string
+	Thinking    string // reasoning streamed before the reply, kept apart from Text
+	ToolCalls   []ToolCall
+	ToolResults []ToolResult
+	// ThinkingSignature lets the provider verify Thinking when it is sent
+	// back, RedactedThinking is reasoning it returned encrypted. Both have
+	// to be passed back unchanged while tool calls continue a reply.
+	ThinkingSignature string
+	RedactedThinking  []string
+}
+
+type ToolCall struct {
+	ID   string
+	Name string
+	Args map[string]any
+}
+
+type ToolResult struct {
+	ID      string
+	Name    string
+	Content string
+}
 
 type Request struct {
 	Messages []Message
 }
 
 type Arg struct {
-	Type string
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
 }
 
 type Tool struct {
@@ -15,14 +49,99 @@ type Tool struct {
 	Description string
 	Args        map[string]Arg
 	Required    []string
+	// Schema is the full JSON schema of the arguments. When set it takes
+	// precedence over Args and Required.
+	Schema map[string]any
+}
+
+// JSONSchema returns the JSON schema describing the tool's arguments
+func (t Tool) JSONSchema() map[string]any {
+	if t.Schema != nil {
+		return t.Schema
+	}
+	schema := map[string]any{
+		"type":       "object",
+		"properties": t.Args,
+	}
+	if len(t.Required) > 0 {
+		schema["required"] = t.Required
+	}
+	return schema
 }
 
 type Callbacks struct {
 	Text func(string)
 	Tool func(string, map[string]any) string
+	// Thinking is called with the streamed reasoning of models that think
+	// before they reply
+	Thinking func(string)
+	// Usage is called with the usage of every request made
+	Usage func(Usage)
+	// InputEstimate is called with the counted input tokens of a request
+	// before it is sent, by providers that count them
+	InputEstimate func(tokens int64)
+	// Retry is called before a failed request is attempted again after delay
+	Retry func(attempt, maxAttempts int, delay time.Duration, err error)
+}
+
+// Usage counts the tokens consumed by a completion
+type Usage struct {
+	InputTokens  int64
+	OutputTokens int64
+	// Input tokens written to and read from the provider's prompt cache,
+	// not included in InputTokens
+	CacheCreationTokens int64
+	CacheReadTokens     int64
+}
+
+// Provider is an LLM backend
+type Provider interface {
+	// Complete continues the conversation, streaming text and running tool
+	// calls through the callbacks until the model stops calling tools. It
+	// returns the conversation extended by the new turns.
+	Complete(ctx context.Context, messages []Message, tools []Tool, cb Callbacks) ([]Message, Usage, error)
+}
+
+// TokenCounter is implemented by providers that can count the input tokens
+// of a request without sending it
+type TokenCounter interface {
+	CountInputTokens(ctx context.Context, messages []Message, tools []Tool) (int64, error)
+}
+
+// ErrToolLimit is returned by Complete when the model kept calling tools
+// past the provider's limit of tool rounds. The returned conversation ends
+// with results telling the model the calls weren't run.
+var ErrToolLimit = errors.New("tool round limit reached")
+
+// ToolLimitResults answers the tool calls of a reply that weren't run because
+// the limit of tool rounds was reached
+func ToolLimitResults(calls []ToolCall, limit int) Message {
+	results := Message{Role: "tool"}
+	for _, call := range calls {
+		results.ToolResults = append(results.ToolResults, ToolResult{
+			ID:      call.ID,
+			Name:    call.Name,
+			Content: fmt.Sprintf("not executed: the limit of %d tool rounds per prompt was reached. Stop calling tools and tell the user what you have done so far.", limit),
+		})
+	}
+	return results
 }
 
 type SessionSetup struct {
 	System string
 	Tools  []Tool
 }
+
+// SystemText returns the concatenated text of the system messages
+func SystemText(messages []Message) string {
+	var system string
+	for _, m := range messages {
+		if m.Role == "system" {
+			if system != "" {
+				system += "\n\n"
+			}
+			system += m.Text
+		}
+	}
+	return system
+}
@@ -14,14 +14,28 @@ import (
 	"halu/glad"
 )
 
+// DefaultModel is the model requested unless LLM.Model is changed
+const DefaultModel = "Qwen/Qwen2.5-Coder-32B-Instruct-AWQ"
+
 type LLM struct {
 	BaseURL    string
 	HTTPClient *http.Client
+	// Model is the name of the model served by the endpoint
+	Model string
+	// System is the system prompt used when the conversation has none
+	System string
+	// Temperature and TopP use the server defaults when nil
+	Temperature *float64
+	TopP        *float64
+	// MaxToolRounds stops Complete with glad.ErrToolLimit once the model
+	// asks for tools more often than this, 0 for no limit
+	MaxToolRounds int
 }
 
 func NewLLM(baseURL string) *LLM {
 	return &LLM{
 		BaseURL: baseURL,
+		Model:   DefaultModel,
 		HTTPClient: &http.Client{
 			Timeout: time.Second * 300,
 		},
@@ -29,32 +43,59 @@ func NewLLM(baseURL string) *LLM {
 }
 
 type message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // the call a "tool" message answers
+	Name       string     `json:"name,omitempty"`         // the tool that produced a "tool" message
+}
+
+// toolCall is a structured OpenAI tool call. When streamed, the arguments
+// arrive in fragments of the call with the same index.
+type toolCall struct {
+	Index    int    `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
 }
 
 type Session struct {
 	llm      *LLM
-	messages []message
-	tools    []tool
+	tools    []glad.Tool
+	messages []glad.Message
 }
 
 func (l *LLM) NewSession(sa glad.SessionSetup) *Session {
-	c := &Session{llm: l}
+	return &Session{
+		llm:      l,
+		tools:    sa.Tools,
+		messages: []glad.Message{{Role: "system", Text: sa.System}},
+	}
+}
 
-	for _, t := range sa.Tools {
-		// Create JSON schema for parameters
-		params := map[string]interface{}{
-			"type":       "object",
-			"properties": t.Args,
-		}
-		if len(t.Required) > 0 {
-			params["required"] = t.Required
-		}
+func (c *Session) User(content string) {
+	c.messages = append(c.messages, glad.Message{Role: "user", Text: content})
+}
+
+func (c *Session) Complete(ctx context.Context, cb glad.Callbacks) error {
+	messages, _, err := c.llm.Complete(ctx, c.messages, c.tools, cb)
+	if err != nil {
+		return err
+	}
+	c.messages = messages
+	return nil
+}
 
-		paramsJSON, _ := json.Marshal(params)
+// convertTools converts glad tools into OpenAI function definitions
+func convertTools(tools []glad.Tool) []tool {
+	var converted []tool
+	for _, t := range tools {
+		paramsJSON, _ := json.Marshal(t.JSONSchema())
 
-		c.tools = append(c.tools, tool{
+		converted = append(converted, tool{
 			Type: "function",
 			Function: function{
 				Name:        t.Name,
@@ -63,14 +104,43 @@ func (l *LLM) NewSession(sa glad.SessionSetup) *Session {
 			},
 		})
 	}
-
-	c.messages = append(c.messages, message{Role: "system", Content: buildSystemPrompt(sa.System, c.tools)})
-
-	return c
+	return converted
 }
 
-func (c *Session) User(content string) {
-	c.messages = append(c.messages, message{Role: "user", Content: content})
+// convertMessages converts the conversation into the chat format, with the
+// tools described in the system prompt. Tool calls and their results are
+// sent in the structured OpenAI form so the server can correlate them.
+func convertMessages(system string, messages []glad.Message, tools []tool) []message {
+	if text := glad.SystemText(messages); text != "" {
+		system = text
+	}
+	converted := []message{{Role: "system", Content: buildSystemPrompt(system, tools)}}
+	for _, m := range messages {
+		switch m.Role {
+		case "user":
+			converted = append(converted, message{Role: "user", Content: m.Text})
+		case "assistant":
+			reply := message{Role: "assistant", Content: m.Text}
+			for _, call := range m.ToolCalls {
+				argsJSON, _ := json.Marshal(call.Args)
+				tc := toolCall{ID: call.ID, Type: "function"}
+				tc.Function.Name = call.Name
+				tc.Function.Arguments = string(argsJSON)
+				reply.ToolCalls = append(reply.ToolCalls, tc)
+			}
+			converted = append(converted, reply)
+		case "tool":
+			for _, result := range m.ToolResults {
+				converted = append(converted, message{
+					Role:       "tool",
+					Content:    result.Content,
+					ToolCallID: result.ID,
+					Name:       result.Name,
+				})
+			}
+		}
+	}
+	return converted
 }
 
 type function struct {
@@ -85,13 +155,25 @@ type tool struct {
 }
 
 type chatCompletionRequest struct {
-	Model       string    `json:"model"`
-	Messages    []message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
-	TopP        float64   `json:"top_p,omitempty"`
-	Stream      bool      `json:"stream"`
-	Tools       []tool    `json:"tools"`
+	Model         string         `json:"model"`
+	Messages      []message      `json:"messages"`
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+	TopP          *float64       `json:"top_p,omitempty"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+	Tools         []tool         `json:"tools"`
+}
+
+// streamOptions is ignored by servers that don't support it
+type streamOptions struct {
+	// IncludeUsage asks for a final chunk carrying the usage of the request
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
 }
 
 type chatCompletionResponse struct {
@@ -104,11 +186,15 @@ type chatCompletionResponse struct {
 		FinishReason string  `json:"finish_reason"`
 		Delta        message `json:"delta"`
 	} `json:"choices"`
+	Usage *usage `json:"usage"`
 }
 
 func buildSystemPrompt(systemMsg string, tools []tool) string {
 	var sb strings.Builder
 	sb.WriteString(systemMsg)
+	if len(tools) == 0 {
+		return sb.String()
+	}
 	sb.WriteString("\n\n## Tools\n\nYou have access to the following tools:\n\n")
 
 	for _, tool := range tools {
@@ -122,75 +208,95 @@ func buildSystemPrompt(systemMsg string, tools []tool) string {
 	return sb.String()
 }
 
-// tokenBuffer helps accumulate and analyze incoming tokens
-type tokenBuffer struct {
-	content    strings.Builder
-	pending    strings.Builder // for tokens we're not sure about yet
-	toolCalls  []string        // collects tool calls as raw strings
-	inToolCall bool            // whether we're currently in a tool call
-}
+// Complete implements glad.Provider
+func (l *LLM) Complete(ctx context.Context, messages []glad.Message, tools []glad.Tool, cb glad.Callbacks) ([]glad.Message, glad.Usage, error) {
+	var total glad.Usage
+	rounds := 0
+	for {
+		reply, usage, err := l.completeOnce(ctx, messages, tools, cb)
+		total.InputTokens += usage.InputTokens
+		total.OutputTokens += usage.OutputTokens
+		if err != nil {
+			return messages, total, err
+		}
+		messages = append(messages, reply)
 
-// normalizeTag removes whitespace from a tag for comparison
-func normalizeTag(tag string) string {
-	return strings.Join(strings.Fields(tag), "")
-}
+		if cb.Usage != nil {
+			cb.Usage(usage)
+		}
 
-// tryFlushText attempts to flush accumulated text if it's not part of a tool call
-func tryFlushText(buf *tokenBuffer, cb glad.Callbacks) {
-	if !buf.inToolCall && buf.content.Len() > 0 {
-		if cb.Text != nil {
-			cb.Text(buf.content.String())
+		if len(reply.ToolCalls) == 0 {
+			return messages, total, nil
+		}
+
+		rounds++
+		if l.MaxToolRounds > 0 && rounds > l.MaxToolRounds {
+			messages = append(messages, glad.ToolLimitResults(reply.ToolCalls, l.MaxToolRounds))
+			return messages, total, glad.ErrToolLimit
 		}
-		buf.content.Reset()
-	}
-}
 
-// tryFlushPending moves pending content to main content and flushes if not in tool call
-func tryFlushPending(buf *tokenBuffer, cb glad.Callbacks) {
-	if buf.pending.Len() > 0 {
-		buf.content.WriteString(buf.pending.String())
-		buf.pending.Reset()
-		if !buf.inToolCall {
-			tryFlushText(buf, cb)
+		results := glad.Message{Role: "tool"}
+		for _, call := range reply.ToolCalls {
+			results.ToolResults = append(results.ToolResults, glad.ToolResult{
+				ID:      call.ID,
+				Name:    call.Name,
+				Content: cb.Tool(call.Name, call.Args),
+			})
 		}
+		messages = append(messages, results)
 	}
 }
 
-func (c *Session) Complete(ctx context.Context, cb glad.Callbacks) error {
+// completeOnce streams a single assistant reply
+func (l *LLM) completeOnce(ctx context.Context, messages []glad.Message, tools []glad.Tool, cb glad.Callbacks) (glad.Message, glad.Usage, error) {
+	qwenTools := convertTools(tools)
 	req := chatCompletionRequest{
-		Model:    "Qwen/Qwen2.5-Coder-32B-Instruct-AWQ",
-		Stream:   true,
-		Tools:    c.tools,
-		Messages: c.messages,
+		Model:         l.Model,
+		Stream:        true,
+		StreamOptions: &streamOptions{IncludeUsage: true},
+		Tools:         qwenTools,
+		Messages:      convertMessages(l.System, messages, qwenTools),
+		Temperature:   l.Temperature,
+		TopP:          l.TopP,
 	}
 
 	jsonData, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("error marshaling request: %w", err)
+		return glad.Message{}, glad.Usage{}, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", c.llm.BaseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", l.BaseURL+"/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
+		return glad.Message{}, glad.Usage{}, fmt.Errorf("error creating request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Accept", "text/event-stream")
 
-	resp, err := c.llm.HTTPClient.Do(httpReq)
+	resp, err := l.HTTPClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("error making request: %w", err)
+		return glad.Message{}, glad.Usage{}, fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		return glad.Message{}, glad.Usage{}, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
 	}
 
 	reader := bufio.NewReader(resp.Body)
-	var fullContent string
-	buf := &tokenBuffer{}
+	usage := glad.Usage{}
+	var text strings.Builder
+	// Servers with function calling support send structured tool calls,
+	// others leave the model's <tool_call> tags in the text
+	var nativeCalls []*toolCall
+	nativeIndex := make(map[int]*toolCall)
+	parser := &toolCallParser{text: func(s string) {
+		text.WriteString(s)
+		if cb.Text != nil {
+			cb.Text(s)
+		}
+	}}
 
 	for {
 		line, err := reader.ReadBytes('\n')
@@ -198,7 +304,7 @@ func (c *Session) Complete(ctx context.Context, cb glad.Callbacks) error {
 			if err == io.EOF {
 				break
 			}
-			return fmt.Errorf("error reading stream: %w", err)
+			return glad.Message{}, glad.Usage{}, fmt.Errorf("error reading stream: %w", err)
 		}
 
 		if len(bytes.TrimSpace(line)) == 0 {
@@ -213,7 +319,13 @@ func (c *Session) Complete(ctx context.Context, cb glad.Callbacks) error {
 
 		var streamResp chatCompletionResponse
 		if err := json.Unmarshal(line, &streamResp); err != nil {
-			return fmt.Errorf("error unmarshaling stream response: %w\nline: %s", err, string(line))
+			return glad.Message{}, glad.Usage{}, fmt.Errorf("error unmarshaling stream response: %w\nline: %s", err, string(line))
+		}
+
+		// The usage arrives with the last chunk, which has no choices
+		if streamResp.Usage != nil {
+			usage.InputTokens = streamResp.Usage.PromptTokens
+			usage.OutputTokens = streamResp.Usage.CompletionTokens
 		}
 
 		for _, choice := range streamResp.Choices {
@@ -222,86 +334,85 @@ func (c *Session) Complete(ctx context.Context, cb glad.Callbacks) error {
 				content = choice.Message.Content
 			}
 
-			if content != "" {
-				fullContent += content
-
-				// Process content character by character
-				for i := 0; i < len(content); i++ {
-					ch := content[i]
-					if ch == '<' {
-						// Start buffering in pending
-						buf.pending.WriteByte(ch)
-					} else if buf.pending.Len() > 0 {
-						// Already buffering, continue in pending
-						buf.pending.WriteByte(ch)
-
-						pendingStr := buf.pending.String()
-						if strings.HasSuffix(pendingStr, ">") {
-							normalized := normalizeTag(pendingStr)
-							if normalized == "<tool_call>" {
-								// Found start of tool call
-								buf.inToolCall = true
-								buf.content.WriteString(pendingStr)
-								buf.pending.Reset()
-							} else if normalized == "</tool_call>" {
-								// Found end of tool call
-								buf.content.WriteString(pendingStr)
-								// Store the complete tool call
-								buf.toolCalls = append(buf.toolCalls, buf.content.String())
-								buf.content.Reset()
-								buf.pending.Reset()
-								buf.inToolCall = false
-							} else if !strings.HasPrefix(normalized, "<tool_call") && !strings.HasPrefix(normalized, "</tool_call") {
-								// Not a tool call tag, flush pending as regular text
-								tryFlushPending(buf, cb)
-							}
-						} else if buf.pending.Len() > 20 {
-							// Too long to be a tag, flush as regular text
-							tryFlushPending(buf, cb)
-						}
-					} else {
-						// Regular character outside of potential tag
-						buf.content.WriteByte(ch)
-						tryFlushText(buf, cb)
-					}
+			parser.Write(content)
+
+			deltas := choice.Delta.ToolCalls
+			complete := len(deltas) == 0
+			if complete {
+				deltas = choice.Message.ToolCalls
+			}
+			for _, delta := range deltas {
+				// Complete calls carry no index, each is a call of its own
+				index := delta.Index
+				if complete {
+					index = -1 - len(nativeCalls)
+				}
+				call, ok := nativeIndex[index]
+				if !ok {
+					call = &toolCall{Index: index}
+					nativeIndex[index] = call
+					nativeCalls = append(nativeCalls, call)
+				}
+				if delta.ID != "" {
+					call.ID = delta.ID
 				}
+				if delta.Function.Name != "" {
+					call.Function.Name = delta.Function.Name
+				}
+				call.Function.Arguments += delta.Function.Arguments
 			}
 		}
 	}
 
-	// Final flushes
-	tryFlushPending(buf, cb)
-	tryFlushText(buf, cb)
-
-	c.messages = append(c.messages, message{
-		Role:    "assistant",
-		Content: fullContent,
-	})
-
-	// Process any collected tool calls
-	for _, rawCall := range buf.toolCalls {
-		// Extract JSON content between tags
-		start := strings.Index(rawCall, ">") + 1
-		end := strings.LastIndex(rawCall, "<")
-		if start > 0 && end > start {
-			jsonStr := strings.TrimSpace(rawCall[start:end])
-			var call map[string]any
-			if err := json.Unmarshal([]byte(jsonStr), &call); err == nil {
-				if name, ok := call["name"].(string); ok {
-					result := cb.Tool(name, call)
-					c.messages = append(c.messages, message{
-						Role:    "system",
-						Content: fmt.Sprintf("%s\n", result),
-					})
-				}
-			}
+	parser.Close()
+
+	reply := glad.Message{Role: "assistant", Text: text.String()}
+
+	for _, call := range nativeCalls {
+		if call.Function.Name == "" {
+			continue
 		}
+		id := call.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", len(reply.ToolCalls))
+		}
+		reply.ToolCalls = append(reply.ToolCalls, glad.ToolCall{
+			ID:   id,
+			Name: call.Function.Name,
+			Args: toolArgs(call.Function.Arguments),
+		})
 	}
 
-	if len(buf.toolCalls) > 0 {
-		return c.Complete(ctx, cb)
+	// Process any tool calls found in the text
+	for _, body := range parser.toolCalls {
+		var call struct {
+			Name      string `json:"name"`
+			Arguments any    `json:"arguments"`
+		}
+		if err := json.Unmarshal([]byte(body), &call); err == nil && call.Name != "" {
+			reply.ToolCalls = append(reply.ToolCalls, glad.ToolCall{
+				ID:   fmt.Sprintf("call_%d", len(reply.ToolCalls)),
+				Name: call.Name,
+				Args: toolArgs(call.Arguments),
+			})
+		}
 	}
 
-	fmt.Println()
-	return nil
+	return reply, usage, nil
+}
+
+// toolArgs decodes tool call arguments, which are either an object or a
+// JSON encoded object
+func toolArgs(arguments any) map[string]any {
+	var args map[string]any
+	switch a := arguments.(type) {
+	case map[string]any:
+		args = a
+	case string:
+		json.Unmarshal([]byte(a), &args)
+	}
+	if args == nil {
+		args = make(map[string]any)
+	}
+	return args
 }
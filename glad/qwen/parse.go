@@ -0,0 +1,106 @@
+package qwen
+
+import (
+	"strings"
+)
+
+const (
+	toolCallOpen  = "<tool_call>"
+	toolCallClose = "</tool_call>"
+	// maxTagLen bounds how much text is held back while waiting to see
+	// whether a '<' starts a tag, allowing for whitespace inside the tag
+	maxTagLen = 32
+)
+
+// toolCallParser splits streamed model output into plain text and the bodies
+// of <tool_call> blocks. Chunks may split tags at any point, several tool
+// calls may follow each other directly, and a '<' that doesn't start a tag
+// is passed through as text.
+type toolCallParser struct {
+	text       func(string)    // receives plain text as soon as it's known not to be a tag
+	content    strings.Builder // plain text, or the body of the current tool call
+	pending    strings.Builder // a possible tag we're not sure about yet
+	inToolCall bool            // whether we're currently in a tool call
+	toolCalls  []string        // bodies of the completed tool calls
+}
+
+// normalizeTag removes whitespace from a tag for comparison
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(tag), "")
+}
+
+// Write feeds the next chunk of streamed output
+func (p *toolCallParser) Write(chunk string) {
+	for i := 0; i < len(chunk); i++ {
+		ch := chunk[i]
+		if ch != '<' && p.pending.Len() == 0 {
+			p.content.WriteByte(ch)
+			continue
+		}
+
+		// A new '<' means the pending one wasn't a tag
+		if ch == '<' {
+			p.flushPending()
+		}
+		p.pending.WriteByte(ch)
+
+		tag := normalizeTag(p.pending.String())
+		switch {
+		case tag == toolCallOpen:
+			p.pending.Reset()
+			if p.inToolCall {
+				// The previous call was never closed, keep it anyway
+				p.endToolCall()
+			}
+			p.flushText()
+			p.inToolCall = true
+		case tag == toolCallClose:
+			p.pending.Reset()
+			if p.inToolCall {
+				p.endToolCall()
+			}
+		case !strings.HasPrefix(toolCallOpen, tag) && !strings.HasPrefix(toolCallClose, tag),
+			p.pending.Len() > maxTagLen:
+			p.flushPending()
+		}
+	}
+	p.flushText()
+}
+
+// Close flushes whatever is buffered at the end of the stream. An unclosed
+// tool call at the very end is kept, as models often stop right before the
+// closing tag.
+func (p *toolCallParser) Close() {
+	p.flushPending()
+	if p.inToolCall {
+		p.endToolCall()
+	}
+	p.flushText()
+}
+
+// flushPending moves a pending non-tag into the content
+func (p *toolCallParser) flushPending() {
+	if p.pending.Len() > 0 {
+		p.content.WriteString(p.pending.String())
+		p.pending.Reset()
+	}
+}
+
+// flushText emits the accumulated content unless it belongs to a tool call
+func (p *toolCallParser) flushText() {
+	if !p.inToolCall && p.content.Len() > 0 {
+		if p.text != nil {
+			p.text(p.content.String())
+		}
+		p.content.Reset()
+	}
+}
+
+// endToolCall stores the body of the current tool call
+func (p *toolCallParser) endToolCall() {
+	if body := strings.TrimSpace(p.content.String()); body != "" {
+		p.toolCalls = append(p.toolCalls, body)
+	}
+	p.content.Reset()
+	p.inToolCall = false
+}
@@ -0,0 +1,74 @@
+package qwen
+
+import (
+	"reflect"
+	"testing"
+)
+
+// parse feeds stream to a toolCallParser in chunks of size bytes and returns
+// the plain text and tool call bodies it found
+func parse(stream string, size int) (string, []string) {
+	var text string
+	p := &toolCallParser{text: func(s string) { text += s }}
+	for len(stream) > 0 {
+		n := min(size, len(stream))
+		p.Write(stream[:n])
+		stream = stream[n:]
+	}
+	p.Close()
+	return text, p.toolCalls
+}
+
+func TestToolCallParser(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		text      string
+		toolCalls []string
+	}{
+		{
+			name:      "text and a tool call",
+			stream:    "Let me look.\n<tool_call>\n{\"name\": \"read_file\"}\n</tool_call>",
+			text:      "Let me look.\n",
+			toolCalls: []string{`{"name": "read_file"}`},
+		},
+		{
+			name:      "back to back tool calls",
+			stream:    "<tool_call>{\"name\": \"a\"}</tool_call><tool_call>{\"name\": \"b\"}</tool_call>",
+			toolCalls: []string{`{"name": "a"}`, `{"name": "b"}`},
+		},
+		{
+			name:   "stray less-than in text",
+			stream: "if a < b && c<d {\n\treturn <-ch\n}",
+			text:   "if a < b && c<d {\n\treturn <-ch\n}",
+		},
+		{
+			name:      "less-than before a tool call",
+			stream:    "x <tool> y <<tool_call>{\"name\": \"a\"}</tool_call>",
+			text:      "x <tool> y <",
+			toolCalls: []string{`{"name": "a"}`},
+		},
+		{
+			name:      "whitespace inside tags",
+			stream:    "< tool_call >{\"name\": \"a\"}</ tool_call>",
+			toolCalls: []string{`{"name": "a"}`},
+		},
+		{
+			name:      "unclosed tool call at the end",
+			stream:    "<tool_call>{\"name\": \"a\"}",
+			toolCalls: []string{`{"name": "a"}`},
+		},
+	}
+	for _, tt := range tests {
+		// Every chunk size splits the tags somewhere else
+		for size := 1; size <= len(tt.stream); size++ {
+			text, toolCalls := parse(tt.stream, size)
+			if text != tt.text {
+				t.Errorf("%s, chunks of %d: text = %q, want %q", tt.name, size, text, tt.text)
+			}
+			if !reflect.DeepEqual(toolCalls, tt.toolCalls) {
+				t.Errorf("%s, chunks of %d: tool calls = %q, want %q", tt.name, size, toolCalls, tt.toolCalls)
+			}
+		}
+	}
+}
@@ -23,6 +23,7 @@ var styleHeader = lipgloss.NewStyle().
 
 func main() {
 	baseURL := flag.String("url", "http://localhost:8000", "vLLM server base URL")
+	model := flag.String("model", qwen.DefaultModel, "Model name served by the endpoint")
 	prompt := flag.String("prompt", "", "Text prompt for completion")
 	flag.Parse()
 
@@ -33,6 +34,7 @@ func main() {
 	}
 
 	llm := qwen.NewLLM(*baseURL)
+	llm.Model = *model
 
 	chat := llm.NewSession(glad.SessionSetup{
 		System: "you are GLaDOS, a coding assistant",
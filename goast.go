@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseGoFiles parses a single Go file, or every Go file below a directory.
+// Dot directories, testdata and vendor are skipped.
+func parseGoFiles(path string) (*token.FileSet, []*ast.File, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !info.IsDir() {
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fset, []*ast.File{file}, nil
+	}
+
+	err = filepath.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if currentPath != path && (strings.HasPrefix(name, ".") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(currentPath, ".go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, currentPath, nil, parser.ParseComments)
+		if err != nil {
+			// Skip files that don't parse rather than failing the whole scan
+			return nil
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fset, files, nil
+}
+
+// importedAs returns the local name under which file imports pkgPath,
+// or an empty string if the package isn't imported
+func importedAs(file *ast.File, pkgPath string) string {
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || p != pkgPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return filepath.Base(p)
+	}
+	return ""
+}
+
+// isPkgCall reports whether call is pkg.Name(...) where pkg is the local
+// name of an import, and returns the called function name
+func isPkgCall(call *ast.CallExpr, localName string) (string, bool) {
+	if localName == "" || localName == "_" {
+		return "", false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	if !ok || ident.Name != localName {
+		return "", false
+	}
+	return sel.Sel.Name, true
+}
+
+// positionString formats a position as file:line
+func positionString(fset *token.FileSet, pos token.Pos) string {
+	p := fset.Position(pos)
+	return p.Filename + ":" + strconv.Itoa(p.Line)
+}
+
+// typeCheck type-checks parsed files, grouped into packages by directory and
+// package name. Type errors are tolerated so that partially broken code still
+// yields as much type information as possible.
+func typeCheck(fset *token.FileSet, files []*ast.File) *types.Info {
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+
+	packages := make(map[string][]*ast.File)
+	var order []string
+	for _, file := range files {
+		key := filepath.Dir(fset.Position(file.Pos()).Filename) + ":" + file.Name.Name
+		if _, ok := packages[key]; !ok {
+			order = append(order, key)
+		}
+		packages[key] = append(packages[key], file)
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	for _, key := range order {
+		pkgFiles := packages[key]
+		conf.Check(pkgFiles[0].Name.Name, fset, pkgFiles, info)
+	}
+
+	return info
+}
+
+// funcDeclName returns the name of a function declaration, qualified with the
+// receiver type for methods, e.g. "Agent.Run"
+func funcDeclName(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return fd.Name.Name
+	}
+	recv := fd.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	switch r := recv.(type) {
+	case *ast.IndexExpr:
+		recv = r.X
+	case *ast.IndexListExpr:
+		recv = r.X
+	}
+	if ident, ok := recv.(*ast.Ident); ok {
+		return ident.Name + "." + fd.Name.Name
+	}
+	return fd.Name.Name
+}
+
+// findFuncDecls returns the function declarations matching name, which may
+// be a plain name or a receiver-qualified one like "Agent.Run"
+func findFuncDecls(files []*ast.File, name string) []*ast.FuncDecl {
+	var decls []*ast.FuncDecl
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if fd.Name.Name == name || funcDeclName(fd) == name {
+				decls = append(decls, fd)
+			}
+		}
+	}
+	return decls
+}
+
+// parseGoPackage parses the Go file at path together with the other files of
+// its package in the same directory, so that it can be type-checked. The file
+// itself is returned separately.
+func parseGoPackage(path string) (*token.FileSet, *ast.File, []*ast.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+	target, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	files := []*ast.File{target}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, entry := range entries {
+		name := filepath.Join(filepath.Dir(path), entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		if abs, err := filepath.Abs(name); err != nil || abs == absPath {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil || file.Name.Name != target.Name.Name {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	return fset, target, files, nil
+}
+
+// textEdit replaces the bytes between Start and End offsets with Text
+type textEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// applyEdits applies non-overlapping edits to src
+func applyEdits(src []byte, edits []textEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start > edits[j].Start })
+	out := append([]byte{}, src...)
+	for _, e := range edits {
+		out = append(out[:e.Start], append([]byte(e.Text), out[e.End:]...)...)
+	}
+	return out
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
+
+// addImportEdit returns an edit adding pkgPath to the imports of file, or
+// false if it is already imported
+func addImportEdit(fset *token.FileSet, file *ast.File, pkgPath string) (textEdit, bool) {
+	if importedAs(file, pkgPath) != "" {
+		return textEdit{}, false
+	}
+	quoted := strconv.Quote(pkgPath)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if gen.Lparen.IsValid() {
+			offset := fset.Position(gen.Lparen).Offset + 1
+			return textEdit{Start: offset, End: offset, Text: "\n\t" + quoted}, true
+		}
+		offset := fset.Position(gen.End()).Offset
+		return textEdit{Start: offset, End: offset, Text: "\nimport " + quoted}, true
+	}
+	offset := fset.Position(file.Name.End()).Offset
+	return textEdit{Start: offset, End: offset, Text: "\n\nimport " + quoted}, true
+}
+
+// formatIfClean runs gofmt on the edited source, but only when the original
+// source was already gofmt-clean, so unrelated formatting doesn't show up in diffs
+func formatIfClean(original, edited []byte) []byte {
+	formatted, err := format.Source(original)
+	if err != nil || !bytes.Equal(formatted, original) {
+		return edited
+	}
+	formatted, err = format.Source(edited)
+	if err != nil {
+		return edited
+	}
+	return formatted
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// goimportsCheck runs goimports on a Go file a tool just changed and
+// applies its fixes. The returned note tells the model what goimports
+// changed or why it failed, so it can correct its edit; it is empty when
+// the file was already clean.
+func goimportsCheck(path string) string {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("goimports", path)
+	cmd.Stderr = &stderr
+	formatted, err := cmd.Output()
+	if err != nil {
+		return fmt.Sprintf("goimports failed on %s, the file may not compile:\n%s", path, strings.TrimSpace(stderr.String()))
+	}
+
+	// goimports writes \n line endings
+	if usesCRLF(original) {
+		formatted = toCRLF(formatted)
+	}
+	if bytes.Equal(formatted, original) {
+		return ""
+	}
+	if err := writeFileAtomic(path, formatted); err != nil {
+		return fmt.Sprintf("goimports would change %s but writing it failed: %v", path, err)
+	}
+	return "goimports changed " + path + ":\n" + unifiedDiff(path, path, string(original), string(formatted))
+}
+
+// editedGoFile returns the Go file a writing tool's input names, or "" if
+// it doesn't name one
+func (a *Agent) editedGoFile(tool Tool, input map[string]interface{}) string {
+	if !a.goimports || !tool.writesFor(input) {
+		return ""
+	}
+	path, _ := input["path"].(string)
+	if !strings.HasSuffix(path, ".go") || !a.isPathSafe(path) {
+		return ""
+	}
+	return path
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/sourcegraph/jsonrpc2"
 )
@@ -74,93 +77,20 @@ func (s *streamReadWriteCloser) Close() error {
 	return s.stdout.Close()
 }
 
-func findType(filePath, typeName string) (*TypeLocation, error) {
+func (s *goplsSession) findType(filePath, typeName string) (*TypeLocation, error) {
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get absolute path: %v", err)
 	}
 
-	// Read the file content
-	fileContent, err := os.ReadFile(absPath)
+	fileContent, fileURI, _, err := s.sync(absPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %v", err)
+		return nil, err
 	}
 
-	// Start gopls
-	cmd := exec.Command("gopls", "serve")
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %v", err)
-	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdout pipe: %v", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start gopls: %v", err)
-	}
-	defer cmd.Process.Kill()
-
-	rwc := &streamReadWriteCloser{stdin: stdin, stdout: stdout}
-	stream := jsonrpc2.NewBufferedStream(rwc, jsonrpc2.VSCodeObjectCodec{})
-	conn := jsonrpc2.NewConn(context.Background(), stream, jsonrpc2.HandlerWithError(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) (interface{}, error) {
-		return nil, nil
-	}))
-
-	workspaceDir := filepath.Dir(absPath)
-	fileURI := "file://" + absPath
-
-	// Initialize gopls
-	var initResult interface{}
-	err = conn.Call(context.Background(), "initialize", map[string]interface{}{
-		"processId": os.Getpid(),
-		"rootUri":   "file://" + workspaceDir,
-		"workspaceFolders": []map[string]interface{}{
-			{"uri": "file://" + workspaceDir, "name": filepath.Base(workspaceDir)},
-		},
-		"capabilities": map[string]interface{}{
-			"textDocument": map[string]interface{}{
-				"documentSymbol": map[string]interface{}{
-					"hierarchicalDocumentSymbolSupport": true,
-				},
-			},
-			"workspace": map[string]interface{}{
-				"workspaceFolders": true,
-			},
-		},
-	}, &initResult)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize: %v", err)
-	}
-
-	// Send required notifications
-	err = conn.Notify(context.Background(), "initialized", map[string]interface{}{})
+	symbols, err := s.documentSymbols(fileURI)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send initialized notification: %v", err)
-	}
-
-	err = conn.Notify(context.Background(), "textDocument/didOpen", map[string]interface{}{
-		"textDocument": map[string]interface{}{
-			"uri":        fileURI,
-			"languageId": "go",
-			"version":    1,
-			"text":       string(fileContent),
-		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to send didOpen notification: %v", err)
-	}
-
-	// Get document symbols
-	var symbols []DocumentSymbol
-	err = conn.Call(context.Background(), "textDocument/documentSymbol", map[string]interface{}{
-		"textDocument": map[string]interface{}{
-			"uri": fileURI,
-		},
-	}, &symbols)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get document symbols: %v", err)
+		return nil, err
 	}
 
 	// Find the type
@@ -189,11 +119,6 @@ func findType(filePath, typeName string) (*TypeLocation, error) {
 	}
 	findType(symbols)
 
-	// Cleanup
-	var shutdownResult interface{}
-	_ = conn.Call(context.Background(), "shutdown", nil, &shutdownResult)
-	_ = conn.Notify(context.Background(), "exit", nil)
-
 	if location == nil {
 		return nil, fmt.Errorf("type %s not found in %s", typeName, filePath)
 	}
@@ -201,19 +126,85 @@ func findType(filePath, typeName string) (*TypeLocation, error) {
 	return location, nil
 }
 
-func findFunction(filePath, funcName string) (*FunctionLocation, error) {
+func (s *goplsSession) findFunction(filePath, funcName string) (*FunctionLocation, error) {
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get absolute path: %v", err)
 	}
 
-	// Read the file content
-	fileContent, err := os.ReadFile(absPath)
+	fileContent, fileURI, _, err := s.sync(absPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %v", err)
+		return nil, err
 	}
 
-	// Start gopls
+	symbols, err := s.documentSymbols(fileURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the function
+	var location *FunctionLocation
+	var findFunc func([]DocumentSymbol) bool
+	findFunc = func(syms []DocumentSymbol) bool {
+		for _, symbol := range syms {
+			if symbol.Kind == 12 && symbol.Name == funcName { // 12 is Function kind in LSP
+				lines := strings.Split(string(fileContent), "\n")
+				content := strings.Join(lines[symbol.Range.Start.Line:symbol.Range.End.Line+1], "\n")
+				location = &FunctionLocation{
+					StartLine:   symbol.Range.Start.Line + 1,
+					EndLine:     symbol.Range.End.Line + 1,
+					Name:        funcName,
+					Content:     content,
+					StartColumn: symbol.Range.Start.Character + 1,
+					EndColumn:   symbol.Range.End.Character + 1,
+				}
+				return true
+			}
+			if len(symbol.Children) > 0 && findFunc(symbol.Children) {
+				return true
+			}
+		}
+		return false
+	}
+	findFunc(symbols)
+
+	if location == nil {
+		return nil, fmt.Errorf("function %s not found in %s", funcName, filePath)
+	}
+
+	return location, nil
+}
+
+// Diagnostic is an error or warning gopls reports for a file
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// Location is a range in a file, as returned by textDocument/definition
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// goplsSession is a running gopls server with an initialized connection. It
+// tracks the files it has opened so they can be kept in sync with the disk.
+type goplsSession struct {
+	cmd  *exec.Cmd
+	conn *jsonrpc2.Conn
+
+	mu          sync.Mutex
+	versions    map[string]int                 // version of every opened file by URI
+	texts       map[string]string              // content gopls last saw of every opened file
+	diagnostics map[string][]Diagnostic        // latest published diagnostics by URI
+	watchers    map[string][]chan []Diagnostic // waiting for the next diagnostics by URI
+}
+
+// startGopls starts gopls serve for the workspace directory and initializes
+// it
+func startGopls(workspaceDir string) (*goplsSession, error) {
 	cmd := exec.Command("gopls", "serve")
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -227,20 +218,20 @@ func findFunction(filePath, funcName string) (*FunctionLocation, error) {
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start gopls: %v", err)
 	}
-	defer cmd.Process.Kill()
 
+	s := &goplsSession{
+		cmd:         cmd,
+		versions:    make(map[string]int),
+		texts:       make(map[string]string),
+		diagnostics: make(map[string][]Diagnostic),
+		watchers:    make(map[string][]chan []Diagnostic),
+	}
 	rwc := &streamReadWriteCloser{stdin: stdin, stdout: stdout}
 	stream := jsonrpc2.NewBufferedStream(rwc, jsonrpc2.VSCodeObjectCodec{})
-	conn := jsonrpc2.NewConn(context.Background(), stream, jsonrpc2.HandlerWithError(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) (interface{}, error) {
-		return nil, nil
-	}))
-
-	workspaceDir := filepath.Dir(absPath)
-	fileURI := "file://" + absPath
+	s.conn = jsonrpc2.NewConn(context.Background(), stream, jsonrpc2.HandlerWithError(s.handle))
 
-	// Initialize gopls
 	var initResult interface{}
-	err = conn.Call(context.Background(), "initialize", map[string]interface{}{
+	err = s.conn.Call(context.Background(), "initialize", map[string]interface{}{
 		"processId": os.Getpid(),
 		"rootUri":   "file://" + workspaceDir,
 		"workspaceFolders": []map[string]interface{}{
@@ -251,6 +242,9 @@ func findFunction(filePath, funcName string) (*FunctionLocation, error) {
 				"documentSymbol": map[string]interface{}{
 					"hierarchicalDocumentSymbolSupport": true,
 				},
+				"hover": map[string]interface{}{
+					"contentFormat": []string{"plaintext"},
+				},
 			},
 			"workspace": map[string]interface{}{
 				"workspaceFolders": true,
@@ -258,72 +252,219 @@ func findFunction(filePath, funcName string) (*FunctionLocation, error) {
 		},
 	}, &initResult)
 	if err != nil {
+		s.Close()
 		return nil, fmt.Errorf("failed to initialize: %v", err)
 	}
 
-	// Send required notifications
-	err = conn.Notify(context.Background(), "initialized", map[string]interface{}{})
-	if err != nil {
+	if err := s.conn.Notify(context.Background(), "initialized", map[string]interface{}{}); err != nil {
+		s.Close()
 		return nil, fmt.Errorf("failed to send initialized notification: %v", err)
 	}
+	return s, nil
+}
 
-	err = conn.Notify(context.Background(), "textDocument/didOpen", map[string]interface{}{
+// handle receives the requests and notifications gopls sends. Only published
+// diagnostics are of interest, everything else is acknowledged.
+func (s *goplsSession) handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (interface{}, error) {
+	if req.Method != "textDocument/publishDiagnostics" || req.Params == nil {
+		return nil, nil
+	}
+	var params struct {
+		URI         string       `json:"uri"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(*req.Params, &params); err != nil {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diagnostics[params.URI] = params.Diagnostics
+	for _, watcher := range s.watchers[params.URI] {
+		select {
+		case watcher <- params.Diagnostics:
+		default:
+		}
+	}
+	return nil, nil
+}
+
+// alive reports whether the gopls process is still connected
+func (s *goplsSession) alive() bool {
+	select {
+	case <-s.conn.DisconnectNotify():
+		return false
+	default:
+		return true
+	}
+}
+
+// sync makes sure gopls sees the file's current content, opening it or
+// sending the changes made since. It returns the content, the file's URI and
+// whether gopls was told about new content.
+func (s *goplsSession) sync(absPath string) ([]byte, string, bool, error) {
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to read file: %v", err)
+	}
+	uri := "file://" + absPath
+
+	s.mu.Lock()
+	version, opened := s.versions[uri]
+	unchanged := opened && s.texts[uri] == string(content)
+	if !unchanged {
+		version++
+		s.versions[uri] = version
+		s.texts[uri] = string(content)
+	}
+	s.mu.Unlock()
+	if unchanged {
+		return content, uri, false, nil
+	}
+
+	if !opened {
+		err = s.conn.Notify(context.Background(), "textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri":        uri,
+				"languageId": "go",
+				"version":    version,
+				"text":       string(content),
+			},
+		})
+		if err != nil {
+			return nil, "", false, fmt.Errorf("failed to send didOpen notification: %v", err)
+		}
+		return content, uri, true, nil
+	}
+
+	err = s.conn.Notify(context.Background(), "textDocument/didChange", map[string]interface{}{
 		"textDocument": map[string]interface{}{
-			"uri":        fileURI,
-			"languageId": "go",
-			"version":    1,
-			"text":       string(fileContent),
+			"uri":     uri,
+			"version": version,
+		},
+		"contentChanges": []map[string]interface{}{
+			{"text": string(content)},
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to send didOpen notification: %v", err)
+		return nil, "", false, fmt.Errorf("failed to send didChange notification: %v", err)
+	}
+	return content, uri, true, nil
+}
+
+// resync sends gopls the changes to every file it has open, so edits made
+// on disk don't leave it with a stale view. Deleted files are closed.
+func (s *goplsSession) resync() {
+	s.mu.Lock()
+	var uris []string
+	for uri := range s.versions {
+		uris = append(uris, uri)
+	}
+	s.mu.Unlock()
+
+	for _, uri := range uris {
+		path := uriPath(uri)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			s.mu.Lock()
+			delete(s.versions, uri)
+			delete(s.texts, uri)
+			s.mu.Unlock()
+			_ = s.conn.Notify(context.Background(), "textDocument/didClose", map[string]interface{}{
+				"textDocument": map[string]interface{}{"uri": uri},
+			})
+			continue
+		}
+		s.sync(path)
+	}
+}
+
+// watchDiagnostics returns a channel receiving the diagnostics gopls
+// publishes for the URI from now on, and a function to stop watching
+func (s *goplsSession) watchDiagnostics(uri string) (<-chan []Diagnostic, func()) {
+	watcher := make(chan []Diagnostic, 16)
+	s.mu.Lock()
+	s.watchers[uri] = append(s.watchers[uri], watcher)
+	s.mu.Unlock()
+
+	return watcher, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		watchers := s.watchers[uri]
+		for i, w := range watchers {
+			if w == watcher {
+				s.watchers[uri] = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
 	}
+}
+
+// lastDiagnostics returns the diagnostics last published for the URI
+func (s *goplsSession) lastDiagnostics(uri string) ([]Diagnostic, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	diagnostics, ok := s.diagnostics[uri]
+	return diagnostics, ok
+}
 
-	// Get document symbols
+// documentSymbols returns the symbols declared in the file
+func (s *goplsSession) documentSymbols(uri string) ([]DocumentSymbol, error) {
 	var symbols []DocumentSymbol
-	err = conn.Call(context.Background(), "textDocument/documentSymbol", map[string]interface{}{
-		"textDocument": map[string]interface{}{
-			"uri": fileURI,
-		},
+	err := s.conn.Call(context.Background(), "textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
 	}, &symbols)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get document symbols: %v", err)
 	}
+	return symbols, nil
+}
 
-	// Find the function
-	var location *FunctionLocation
-	var findFunc func([]DocumentSymbol) bool
-	findFunc = func(syms []DocumentSymbol) bool {
-		for _, symbol := range syms {
-			if symbol.Kind == 12 && symbol.Name == funcName { // 12 is Function kind in LSP
-				lines := strings.Split(string(fileContent), "\n")
-				content := strings.Join(lines[symbol.Range.Start.Line:symbol.Range.End.Line+1], "\n")
-				location = &FunctionLocation{
-					StartLine:   symbol.Range.Start.Line + 1,
-					EndLine:     symbol.Range.End.Line + 1,
-					Name:        funcName,
-					Content:     content,
-					StartColumn: symbol.Range.Start.Character + 1,
-					EndColumn:   symbol.Range.End.Character + 1,
-				}
-				return true
-			}
-			if len(symbol.Children) > 0 && findFunc(symbol.Children) {
-				return true
-			}
+// goplsSession returns the agent's gopls session, starting gopls in the working directory on
+// first use or if it exited. The session lives as long as the agent.
+func (a *Agent) goplsSession() (*goplsSession, error) {
+	if a.gopls != nil {
+		if a.gopls.alive() {
+			return a.gopls, nil
 		}
-		return false
+		a.gopls.Close()
 	}
-	findFunc(symbols)
+	s, err := startGopls(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	a.gopls = s
+	return s, nil
+}
 
-	// Cleanup
+// Close shuts gopls down
+func (s *goplsSession) Close() {
 	var shutdownResult interface{}
-	_ = conn.Call(context.Background(), "shutdown", nil, &shutdownResult)
-	_ = conn.Notify(context.Background(), "exit", nil)
+	_ = s.conn.Call(context.Background(), "shutdown", nil, &shutdownResult)
+	_ = s.conn.Notify(context.Background(), "exit", nil)
+	s.conn.Close()
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+}
 
-	if location == nil {
-		return nil, fmt.Errorf("function %s not found in %s", funcName, filePath)
+// uriPath returns the file path of a file:// URI
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
 	}
+	return strings.TrimPrefix(uri, "file://")
+}
 
-	return location, nil
-}
\ No newline at end of file
+// declaredSymbol returns the symbol whose name is at the position, or nil
+// if the position doesn't name a declaration, e.g. for local variables
+func declaredSymbol(symbols []DocumentSymbol, pos Position) *DocumentSymbol {
+	for i := range symbols {
+		symbol := &symbols[i]
+		if symbol.SelectionRange.Start == pos {
+			return symbol
+		}
+		if inner := declaredSymbol(symbol.Children, pos); inner != nil {
+			return inner
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sort"
+
+	"halu/glad"
+)
+
+// gladTools converts the registered tools into the provider independent glad
+// tool description. The full input schema is kept so no detail is lost for
+// providers that accept JSON schema directly.
+func (a *Agent) gladTools() []glad.Tool {
+	var names []string
+	for name := range a.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tools []glad.Tool
+	for _, name := range names {
+		tool := a.tools[name]
+		gt := glad.Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Args:        make(map[string]glad.Arg),
+			Schema:      tool.InputSchema,
+		}
+		properties, _ := tool.InputSchema["properties"].(map[string]interface{})
+		for argName, prop := range properties {
+			p, _ := prop.(map[string]interface{})
+			arg := glad.Arg{}
+			switch t := p["type"].(type) {
+			case string:
+				arg.Type = t
+			case []string:
+				// glad only knows single types, use the simplest one
+				if len(t) > 0 {
+					arg.Type = t[0]
+				}
+			}
+			arg.Description, _ = p["description"].(string)
+			gt.Args[argName] = arg
+		}
+		gt.Required, _ = tool.InputSchema["required"].([]string)
+		tools = append(tools, gt)
+	}
+	return tools
+}
@@ -3,30 +3,152 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/fatih/color"
 	"github.com/joho/godotenv"
+	"golang.org/x/term"
+	"halu/glad"
+	"halu/glad/claude"
+	"halu/glad/qwen"
 )
 
 // Agent represents our AI agent with its tools and client
 type Agent struct {
-	client *anthropic.Client
-	tools  map[string]Tool
-	yolo   bool
+	provider      glad.Provider
+	tools         map[string]Tool
+	yolo          bool
+	dir           string // working directory the tools operate in
+	allowDirs     []string
+	allowDotfiles bool
+	system        string
+	output        Output
+	context       ContextOptions
+	contextTokens int64             // input tokens of the latest request, i.e. the context in use
+	policy        map[string]string // tool name -> policy, "*" for all others
+	activePolicy  string            // policy of the tool being executed
+	dryRun        bool              // show tool calls without executing them
+	dryRunReads   bool              // in dry run mode, still execute tools that don't write
+	audit         *auditLog         // records tool invocations, nil if disabled
+	gopls         *goplsSession     // started on first use by the gopls tools
+	backup        bool              // back up files before overwriting them
+	redact        bool              // mask secrets in tool results before they are sent
+	maxReadSize   int               // bytes read_file returns at most, 0 for no limit
+	goimports     bool              // run goimports on Go files after tools change them
+	showThinking  bool              // render the model's reasoning
+	maxToolRounds int               // limit of tool call rounds per prompt
+}
+
+// AgentOptions configures a new Agent
+type AgentOptions struct {
+	Yolo           bool     // skip confirmation when writing files
+	ToolsOnly      bool     // only use the tools, without a model
+	Local          bool     // use a local LLM endpoint instead of the Anthropic API
+	URL            string   // base URL of the local OpenAI-compatible endpoint
+	Dir            string   // working directory of the tools, cwd if empty
+	AllowDirs      []string // directories besides cwd the tools may access
+	AllowDotfiles  bool     // allow tools to access dotfiles
+	EnableTools    []string // only register these tools, all if empty
+	DisableTools   []string // don't register these tools
+	ReadOnly       bool     // don't register tools that modify files
+	Temperature    *float64 // sampling temperature, nil for the provider default
+	TopP           *float64 // nucleus sampling, nil for the provider default
+	ThinkingBudget int64    // tokens for extended thinking before each reply, 0 to disable
+	System         string   // system prompt sent with every conversation
+	Context        ContextOptions
+	Output         io.Writer // where progress is rendered, stdout if nil
+	JSONOutput     bool      // render newline delimited JSON events instead of text
+	Quiet          bool      // render only the model's text and a final usage line
+	DryRun         bool      // show tool calls without executing them
+	DryRunReads    bool      // in dry run mode, still execute tools that don't write
+	AuditFile      string    // JSONL log of tool invocations, empty to disable
+	Backup         bool      // back up files before overwriting them
+	Redact         bool      // mask secrets in tool results before they are sent
+	MaxReadSize    int       // bytes read_file returns at most, 0 for no limit
+	Goimports      bool      // run goimports on Go files after tools change them
+	ShowThinking   bool      // render the model's reasoning
+	MaxToolRounds  int       // stop a prompt after this many rounds of tool calls, 0 for no limit
+	CountTokens    bool      // count the input tokens of every request before sending it
+}
+
+// minThinkingBudget is the smallest thinking budget the API accepts
+const minThinkingBudget = 1024
+
+// stringList is a flag.Value collecting repeated string flags
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// optionalFloat is a flag.Value that remembers whether it was set
+type optionalFloat struct {
+	value *float64
+}
+
+func (f *optionalFloat) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.value, 'g', -1, 64)
+}
+
+func (f *optionalFloat) Set(value string) error {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	f.value = &v
+	return nil
 }
 
 // TokenUsage tracks token usage statistics
 type TokenUsage struct {
-	InputTokens  int64
-	OutputTokens int64
+	InputTokens         int64
+	OutputTokens        int64
+	CacheCreationTokens int64
+	CacheReadTokens     int64
+}
+
+// Claude pricing: $3/M for input, $15/M for output. Cache writes cost 25%
+// more than input, cache reads a tenth of it.
+func (u TokenUsage) inputCost() float64      { return float64(u.InputTokens) * 0.000003 }
+func (u TokenUsage) outputCost() float64     { return float64(u.OutputTokens) * 0.000015 }
+func (u TokenUsage) cacheWriteCost() float64 { return float64(u.CacheCreationTokens) * 0.00000375 }
+func (u TokenUsage) cacheReadCost() float64  { return float64(u.CacheReadTokens) * 0.0000003 }
+func (u TokenUsage) cost() float64 {
+	return u.inputCost() + u.outputCost() + u.cacheWriteCost() + u.cacheReadCost()
+}
+
+// cacheSavings is what the cache reads would have cost as regular input
+func (u TokenUsage) cacheSavings() float64 {
+	return float64(u.CacheReadTokens)*0.000003 - u.cacheReadCost()
+}
+
+// add returns the sum of both usages
+func (u TokenUsage) add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputTokens:         u.InputTokens + other.InputTokens,
+		OutputTokens:        u.OutputTokens + other.OutputTokens,
+		CacheCreationTokens: u.CacheCreationTokens + other.CacheCreationTokens,
+		CacheReadTokens:     u.CacheReadTokens + other.CacheReadTokens,
+	}
 }
 
 // Logger colors
@@ -38,6 +160,8 @@ var (
 	errorColor   = color.New(color.FgRed)
 	messageColor = color.New(color.FgBlue)
 	tokenColor   = color.New(color.FgHiBlue)
+	// Reasoning is dimmed so it reads as an aside to the reply
+	thinkingColor = color.New(color.Faint)
 )
 
 // prettyPrint formats and prints JSON-like data
@@ -49,8 +173,8 @@ func prettyPrint(data interface{}) string {
 	return string(bytes)
 }
 
-// NewAgent creates a new AI agent with the given API key
-func NewAgent(yolo bool, local bool) (*Agent, error) {
+// NewAgent creates a new AI agent with the given options
+func NewAgent(opts AgentOptions) (*Agent, error) {
 	// Load environment variables
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -62,214 +186,268 @@ func NewAgent(yolo bool, local bool) (*Agent, error) {
 		}
 	}
 
-	// Get API key from environment
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
-	}
-
-	// Create Anthropic client
-	client := anthropic.NewClient(
-		option.WithAPIKey(apiKey),
-	)
+	// Local mode talks to an OpenAI-compatible endpoint and needs no API key
+	var provider glad.Provider
+	switch {
+	case opts.ToolsOnly:
+		// The tools are called by a client that brings its own model
+	case opts.Local:
+		llm := qwen.NewLLM(opts.URL)
+		llm.System = "You are a coding assistant. Use the tools to read, search and edit code in the current directory."
+		llm.Temperature = opts.Temperature
+		llm.TopP = opts.TopP
+		llm.MaxToolRounds = opts.MaxToolRounds
+		provider = llm
+	default:
+		// Get API key from environment, or from a secret manager command
+		apiKey, err := anthropicAPIKey()
+		if err != nil {
+			return nil, err
+		}
 
-	agent := &Agent{
-		client: client,
-		tools:  make(map[string]Tool),
-		yolo:   yolo,
+		// Create Anthropic client
+		llm := claude.NewLLM(anthropic.NewClient(
+			option.WithAPIKey(apiKey),
+		))
+		llm.Temperature = opts.Temperature
+		llm.TopP = opts.TopP
+		llm.MaxToolRounds = opts.MaxToolRounds
+		llm.CountTokens = opts.CountTokens
+		if opts.ThinkingBudget > 0 {
+			// Limits of the API, see the extended thinking docs
+			if opts.ThinkingBudget < minThinkingBudget {
+				return nil, fmt.Errorf("thinking budget must be at least %d tokens", minThinkingBudget)
+			}
+			if opts.Temperature != nil || opts.TopP != nil {
+				return nil, fmt.Errorf("temperature and top-p can't be set with extended thinking")
+			}
+			llm.ThinkingBudget = opts.ThinkingBudget
+		}
+		provider = llm
 	}
 
-	// Register tools
-	agent.registerTools()
-
-	return agent, nil
-}
-
-// Run starts the interaction with the given prompt
-func (a *Agent) Run(ctx context.Context, prompt string, messages []anthropic.MessageParam) (string, []anthropic.MessageParam, TokenUsage, error) {
-	// Initialize token usage
-	tokenUsage := TokenUsage{}
-
-	// Convert tools to the format expected by the Anthropic API
-	var toolParams []anthropic.ToolUnionUnionParam
-	for _, tool := range a.tools {
-		toolParams = append(toolParams, anthropic.ToolParam{
-			Name:        anthropic.F(tool.Name),
-			Description: anthropic.F(tool.Description),
-			InputSchema: anthropic.F(interface{}(tool.InputSchema)),
-		})
+	// Per tool policies, e.g. HALU_TOOL_POLICY=write_file=confirm,go_vet=auto
+	policy, err := parseToolPolicy(os.Getenv("HALU_TOOL_POLICY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid HALU_TOOL_POLICY: %v", err)
 	}
 
-	// Only add new message if prompt is not empty
-	if strings.TrimSpace(prompt) != "" {
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)))
+	if opts.Context.Window == 0 {
+		opts.Context.Window = 200000
+		if opts.Local {
+			opts.Context.Window = 32768
+		}
 	}
 
-	// Prepare parameters for streaming message
-	streamParams := anthropic.MessageNewParams{
-		Model:     anthropic.F("claude-3-7-sonnet-latest"),
-		MaxTokens: anthropic.F(int64(4096)),
-		Messages:  anthropic.F(messages),
-		Tools:     anthropic.F(toolParams),
+	// Resolve allowed directories once so a later chdir can't change their meaning
+	var allowDirs []string
+	for _, dir := range opts.AllowDirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --allow-dir %s: %v", dir, err)
+		}
+		allowDirs = append(allowDirs, absDir)
 	}
 
-	// Convert tools to MessageCountTokensToolUnionParam type for token counting
-	var tokenCountToolParams []anthropic.MessageCountTokensToolUnionParam
-	for _, tool := range toolParams {
-		if tp, ok := tool.(anthropic.ToolParam); ok {
-			tokenCountToolParams = append(tokenCountToolParams, tp)
+	// The process moves to the working directory, so the relative paths
+	// of tools and the commands they run resolve against it. Allowed
+	// directories were resolved against the original one.
+	if opts.Dir != "" {
+		if err := os.Chdir(opts.Dir); err != nil {
+			return nil, fmt.Errorf("invalid --dir %s: %v", opts.Dir, err)
 		}
 	}
-
-	// Get input token count first
-	tokensCountResult, err := a.client.Messages.CountTokens(ctx, anthropic.MessageCountTokensParams{
-		Model:    streamParams.Model,
-		Messages: streamParams.Messages,
-		Tools:    anthropic.F(tokenCountToolParams),
-	})
+	dir, err := os.Getwd()
 	if err != nil {
-		log.Printf("Warning: Failed to count input tokens: %v", err)
-	} else {
-		tokenUsage.InputTokens = tokensCountResult.InputTokens
+		return nil, fmt.Errorf("failed to get working directory: %v", err)
 	}
 
-	// Retry logic for streaming errors
-	maxRetries := 10
-	var message anthropic.Message
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		// Create the streaming message
-		stream := a.client.Messages.NewStreaming(ctx, streamParams)
-		message = anthropic.Message{}
-
-		// Process the stream
-		for stream.Next() {
-			event := stream.Current()
-			message.Accumulate(event)
-
-			// Track token usage from message delta events
-			if event.Type == anthropic.MessageStreamEventTypeMessageDelta {
-				if messageEvent, ok := event.AsUnion().(anthropic.MessageDeltaEvent); ok {
-					tokenUsage.OutputTokens = messageEvent.Usage.OutputTokens
-				}
-			}
-
-			// Handle content blocks deltas for streaming output
-			if event.Type == anthropic.MessageStreamEventTypeContentBlockDelta {
-				delta := event.Delta.(anthropic.ContentBlockDeltaEventDelta)
-				if delta.Type == anthropic.ContentBlockDeltaEventDeltaTypeTextDelta {
-					fmt.Print(delta.Text)
-				}
-			}
-		}
-
-		// Check for errors
-		if stream.Err() != nil {
-			errMsg := stream.Err().Error()
-			if attempt < maxRetries {
-				fmt.Printf("\n[Retrying due to streaming error %s... Attempt %d/%d]\n", errMsg, attempt+1, maxRetries)
-				continue // Retry
-			}
-
-			// If we've reached max retries or it's a different error, return the error
-			return "", messages, tokenUsage, fmt.Errorf("streaming error: %v", stream.Err())
-		}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
 
-		// If we got here, streaming completed successfully
-		break
+	agent := &Agent{
+		provider:      provider,
+		tools:         make(map[string]Tool),
+		yolo:          opts.Yolo,
+		dir:           dir,
+		allowDirs:     allowDirs,
+		allowDotfiles: opts.AllowDotfiles,
+		system:        opts.System,
+		output:        terminalOutput(out),
+		context:       opts.Context,
+		policy:        policy,
+		dryRun:        opts.DryRun,
+		dryRunReads:   opts.DryRunReads,
+		backup:        opts.Backup,
+		redact:        opts.Redact,
+		maxReadSize:   opts.MaxReadSize,
+		goimports:     opts.Goimports,
+		showThinking:  opts.ShowThinking,
+		maxToolRounds: opts.MaxToolRounds,
+	}
+	if opts.AuditFile != "" {
+		agent.audit = &auditLog{path: opts.AuditFile}
 	}
 
-	fmt.Println() // Add newline after streaming
+	if opts.JSONOutput {
+		agent.output = jsonOutput(out)
+	} else if opts.Quiet {
+		agent.output = quietOutput(agent.output, out)
+	}
 
-	// Get final token usage from the complete message
-	if message.Usage.InputTokens > 0 {
-		tokenUsage.InputTokens = message.Usage.InputTokens
+	// Register tools
+	agent.registerTools()
+	if err := agent.selectTools(opts.EnableTools, opts.DisableTools); err != nil {
+		return nil, err
 	}
-	if message.Usage.OutputTokens > 0 {
-		tokenUsage.OutputTokens = message.Usage.OutputTokens
+	if opts.ReadOnly {
+		agent.makeReadOnly()
 	}
 
-	// Add assistant's message to history
-	messages = append(messages, message.ToParam())
-
-	// Process any tool calls
-	needsToolExecution := false
-	for _, block := range message.Content {
-		if block.Type == "tool_use" {
-			needsToolExecution = true
+	return agent, nil
+}
 
-			// Execute the tool
-			tool, ok := a.tools[block.Name]
-			if !ok {
-				return "", messages, tokenUsage, fmt.Errorf("unknown tool: %s", block.Name)
-			}
+// anthropicAPIKey returns ANTHROPIC_API_KEY, or else the output of the
+// ANTHROPIC_API_KEY_CMD shell command, e.g. "pass show anthropic"
+func anthropicAPIKey() (string, error) {
+	if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
+		return key, nil
+	}
+	command := os.Getenv("ANTHROPIC_API_KEY_CMD")
+	if command == "" {
+		return "", fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
+	}
 
-			var input map[string]interface{}
-			inputBytes, _ := json.Marshal(block.Input)
-			if err := json.Unmarshal(inputBytes, &input); err != nil {
-				return "", messages, tokenUsage, fmt.Errorf("failed to parse tool input: %v", err)
-			}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ANTHROPIC_API_KEY_CMD failed: %v", err)
+	}
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", fmt.Errorf("ANTHROPIC_API_KEY_CMD printed no key")
+	}
+	return key, nil
+}
 
-			// Print tool call with input parameters
-			inputStr := prettyPrint(input)
-
-			// For write_file, ensure the path is always shown in the debug output
-			if block.Name == "write_file" && input["path"] != nil {
-				path := input["path"].(string)
-				if len(inputStr) > 100 {
-					toolColor.Printf("\n➤ tool: %s(path: %s, content: [truncated])\n", block.Name, path)
-				} else {
-					toolColor.Printf("\n➤ tool: %s(%s)\n", block.Name, inputStr)
-				}
-			} else {
-				// Default behavior for other tools
-				if len(inputStr) > 100 {
-					inputStr = inputStr[:97] + "..."
-				}
-				toolColor.Printf("\n➤ tool: %s(%s)\n", block.Name, inputStr)
-			}
+// DefaultSystemPromptFile returns the path of the user's system prompt file
+func DefaultSystemPromptFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".halu", "system.md")
+}
 
-			result, err := tool.Execute(input)
-			errorStr := ""
-			if err != nil {
-				errorStr = fmt.Sprintf("Error: %v", err)
-				errorColor.Printf("➤ Tool execution failed: %v\n", err)
-				result = fmt.Sprintf("tool execution failed: %s", errorStr)
-			}
+// loadSystemPrompt returns the system prompt given on the command line, or
+// the contents of the system prompt file if there is one
+func loadSystemPrompt(system, path string) (string, error) {
+	if system != "" {
+		return system, nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read system prompt: %v", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
 
-			// Add the tool result to the conversation
-			messages = append(messages, anthropic.NewUserMessage(
-				anthropic.NewToolResultBlock(block.ID, result, false),
-			))
+// Close stops the processes the agent started, like gopls
+func (a *Agent) Close() {
+	if a.gopls != nil {
+		a.gopls.Close()
+		a.gopls = nil
+	}
+}
 
-			// Print token usage for the current step
-			tokenColor.Printf("\n⚙ used %d input, %d output tokens\n", tokenUsage.InputTokens, tokenUsage.OutputTokens)
+// withPrompt returns the conversation extended by the prompt
+func (a *Agent) withPrompt(prompt string, messages []glad.Message) []glad.Message {
+	// The system prompt leads a new conversation
+	if len(messages) == 0 && a.system != "" {
+		messages = append(messages, glad.Message{Role: "system", Text: a.system})
+	}
 
-			// Get the next message with the tool result
-			finalResponse, newMessages, newTokenUsage, err := a.Run(ctx, "", messages)
+	// Only add new message if prompt is not empty
+	if strings.TrimSpace(prompt) != "" {
+		messages = append(messages, glad.Message{Role: "user", Text: prompt})
+	}
+	return messages
+}
 
-			// Accumulate the token usage from recursive calls
-			tokenUsage.InputTokens += newTokenUsage.InputTokens
-			tokenUsage.OutputTokens += newTokenUsage.OutputTokens
+// CountTokens returns the input tokens Run would send for the prompt,
+// without calling the model
+func (a *Agent) CountTokens(ctx context.Context, prompt string, messages []glad.Message) (int64, error) {
+	counter, ok := a.provider.(glad.TokenCounter)
+	if !ok {
+		return 0, errors.New("the provider can't count tokens")
+	}
+	return counter.CountInputTokens(ctx, a.withPrompt(prompt, messages), a.gladTools())
+}
 
-			return finalResponse, newMessages, tokenUsage, err
+// Run starts the interaction with the given prompt
+func (a *Agent) Run(ctx context.Context, prompt string, messages []glad.Message) (string, []glad.Message, TokenUsage, error) {
+	messages = a.withPrompt(prompt, messages)
+
+	// Summarize old turns before the conversation outgrows the context window
+	var compactUsage TokenUsage
+	if a.needsCompaction() {
+		compacted, usage, err := a.compactMessages(ctx, messages, a.context.KeepTurns)
+		compactUsage = usage
+		if err != nil {
+			a.output.Notice(err.Error())
+		} else if len(compacted) < len(messages) {
+			a.output.Notice(fmt.Sprintf("compacted %d messages into a summary", len(messages)-len(compacted)+1))
+			messages = compacted
+			a.contextTokens = 0
 		}
 	}
 
-	if !needsToolExecution {
-		// Build final response from message content
-		var finalResponse string
-		for _, block := range message.Content {
-			if block.Type == "text" {
-				finalResponse += block.Text
+	callbacks := glad.Callbacks{
+		Text: a.output.Text,
+		Tool: func(name string, input map[string]any) string {
+			result, err := a.executeTool(name, input)
+			if err != nil {
+				return err.Error()
 			}
-		}
+			return result
+		},
+		Usage: func(usage glad.Usage) {
+			a.contextTokens = usage.InputTokens + usage.CacheCreationTokens + usage.CacheReadTokens
+			a.output.Usage(TokenUsage(usage))
+		},
+		InputEstimate: func(tokens int64) {
+			a.output.Notice(fmt.Sprintf("sending %d input tokens", tokens))
+		},
+		Retry: a.output.Retry,
+	}
+	if a.showThinking {
+		callbacks.Thinking = a.output.Thinking
+	}
+	messages, usage, err := a.provider.Complete(ctx, messages, a.gladTools(), callbacks)
+	total := TokenUsage(usage).add(compactUsage)
+	if errors.Is(err, glad.ErrToolLimit) {
+		// The conversation is intact, the model was told to stop
+		a.output.Notice(fmt.Sprintf("stopped after %d rounds of tool calls, continue with another prompt", a.maxToolRounds))
+		err = nil
+	}
+	if err != nil {
+		return "", messages, total, err
+	}
 
-		stepColor.Println("\n➤ done")
-		return finalResponse, messages, tokenUsage, nil
+	// The final response is the text of the last assistant message
+	var finalResponse string
+	if last := messages[len(messages)-1]; last.Role == "assistant" {
+		finalResponse = last.Text
 	}
 
-	return "", messages, tokenUsage, nil
+	a.output.Done(finalResponse)
+	return finalResponse, messages, total, nil
 }
 
 // prettyTruncate truncates long results for display
@@ -285,24 +463,204 @@ func main() {
 	// Add flags
 	yolo := flag.Bool("yolo", false, "Skip confirmation when writing files")
 	local := flag.Bool("local", false, "Use local LLM endpoint instead of Anthropic API")
+	url := flag.String("url", "http://localhost:8000", "Base URL of the local OpenAI-compatible endpoint used with --local")
+	var allowDirs stringList
+	flag.Var(&allowDirs, "allow-dir", "Allow tools to access this directory in addition to the current one (repeatable)")
+	dir := flag.String("dir", "", "Work in this directory instead of the current one")
+	var enableTools, disableTools stringList
+	flag.Var(&enableTools, "enable", "Only give the model these tools, comma separated (repeatable, default: all)")
+	flag.Var(&disableTools, "disable", "Don't give the model these tools, comma separated (repeatable)")
+	readOnly := flag.Bool("read-only", false, "Only give the model tools that don't modify files, to review or explain code safely. Overrides --enable")
+	allowDotfiles := flag.Bool("allow-dotfiles", false, "Allow tools to access dotfiles such as .github")
+	var temperature, topP optionalFloat
+	flag.Var(&temperature, "temperature", "Sampling temperature, 0 for deterministic output (default: provider default)")
+	flag.Var(&topP, "top-p", "Nucleus sampling probability mass (default: provider default)")
+	thinkingBudget := flag.Int64("thinking-budget", 0, "Let Claude think with up to this many tokens (at least 1024) before each reply, for hard problems. Trades latency and output tokens for quality, use --show-thinking to see the reasoning")
+	system := flag.String("system", "", "System prompt for the agent (default: contents of ~/.halu/system.md if present)")
+	contextWindow := flag.Int64("context-window", 0, "Context window of the model in tokens (default: 200000, or 32768 with --local)")
+	compactAt := flag.Float64("compact-at", 0.8, "Summarize old turns when a request uses this fraction of the context window, 0 to disable")
+	keepTurns := flag.Int("keep-turns", 4, "Number of recent turns kept verbatim when summarizing")
+	historyLimit := flag.Int("history-limit", DefaultHistoryLimit, "Maximum number of prompts kept in ~/.halu_history")
+	vi := flag.Bool("vi", false, "Use vi key bindings at the prompt (or set HALU_VI=1 in ~/.halu.env)")
+	dryRun := flag.Bool("dry-run", false, "Show the tool calls the model makes without executing them")
+	dryRunReads := flag.Bool("dry-run-reads", false, "With --dry-run, still execute tools that don't modify files")
+	auditFile := flag.String("audit-file", DefaultAuditFile(), "File tool invocations are logged to as JSON lines")
+	maxToolRounds := flag.Int("max-tool-rounds", 50, "Stop a prompt after this many rounds of tool calls, 0 for no limit")
+	countTokens := flag.Bool("count-tokens", false, "Count the input tokens of every request before sending it, which costs an extra API call")
+	backup := flag.Bool("backup", false, "Copy files to <file>.<timestamp>.bak before overwriting them")
+	maxReadSize := flag.Int("max-read-size", DefaultMaxReadSize, "Bytes read_file returns at most, larger files are truncated. 0 for no limit")
+	goimports := flag.Bool("goimports", false, "Run goimports on Go files after a tool changes them and tell the model what it fixed (or set HALU_GOIMPORTS=1 in ~/.halu.env)")
+	redact := flag.Bool("redact", false, "Mask API keys, tokens, passwords and private keys in tool results before sending them to the model")
+	noAudit := flag.Bool("no-audit", false, "Don't log tool invocations")
+	diff := flag.String("diff", "", "Viewer for previewing changes: git, plain, or a command like delta or difft (or set HALU_DIFF in ~/.halu.env)")
+	noColor := flag.Bool("no-color", false, "Disable colored output (or set NO_COLOR)")
+	countOnly := flag.Bool("count-only", false, "Print the input tokens and cost of each prompt instead of sending it")
+	addr := flag.String("addr", "localhost:8080", "Address the serve command listens on")
+	showThinking := flag.Bool("show-thinking", false, "Show the model's reasoning, dimmed, before its replies")
+	quiet := flag.Bool("quiet", false, "Only show the model's text and a final usage line, without tool calls and per-step token counts")
+	outputFormat := flag.String("output", "text", "Output format: text, or json for newline delimited JSON events")
+	prompt := flag.String("prompt", "", "Run this prompt non-interactively and exit. The prompt is read from stdin when it isn't a terminal")
 	flag.Parse()
 
-	agent, err := NewAgent(*yolo, *local)
+	// See https://no-color.org
+	if *noColor || os.Getenv("NO_COLOR") != "" {
+		color.NoColor = true
+	}
+
+	// "halu mcp" serves the tools to MCP clients over stdin and stdout,
+	// "halu serve" the agent over HTTP
+	subcommand := flag.Arg(0)
+	if subcommand != "" && subcommand != "mcp" && subcommand != "serve" {
+		errorColor.Printf("Unknown command %q, use mcp or serve\n", subcommand)
+		os.Exit(1)
+	}
+	// The real stdout, for results when everything else printed is
+	// redirected to stderr
+	stdout := os.Stdout
+	if subcommand == "mcp" {
+		// Stdout carries the protocol, anything else printed goes to stderr
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+	}
+
+	// Batch mode runs a single prompt, for scripts and CI
+	batch := subcommand == "" && (*prompt != "" || !term.IsTerminal(int(os.Stdin.Fd())))
+	if batch && *prompt == "" {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			errorColor.Printf("Failed to read prompt from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		*prompt = strings.TrimSpace(string(input))
+		if *prompt == "" {
+			errorColor.Printf("No prompt given on stdin\n")
+			os.Exit(1)
+		}
+	}
+	if *outputFormat != "text" && *outputFormat != "json" {
+		errorColor.Printf("Unknown output format %q, use text or json\n", *outputFormat)
+		os.Exit(1)
+	}
+	jsonEvents := *outputFormat == "json"
+	if batch && !jsonEvents {
+		// Stdout only carries the result, diffs, confirmations and anything
+		// else printed go to stderr
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+	}
+	if *noAudit {
+		*auditFile = ""
+	}
+	var progress io.Writer = os.Stdout
+	if (batch || subcommand == "mcp") && !jsonEvents {
+		progress = os.Stderr
+	}
+
+	systemPrompt, err := loadSystemPrompt(*system, DefaultSystemPromptFile())
+	if err != nil {
+		errorColor.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	agent, err := NewAgent(AgentOptions{
+		Yolo:           *yolo,
+		ToolsOnly:      subcommand == "mcp",
+		Local:          *local,
+		Dir:            *dir,
+		URL:            *url,
+		AllowDirs:      allowDirs,
+		EnableTools:    enableTools,
+		DisableTools:   disableTools,
+		ReadOnly:       *readOnly,
+		AllowDotfiles:  *allowDotfiles,
+		Temperature:    temperature.value,
+		TopP:           topP.value,
+		ThinkingBudget: *thinkingBudget,
+		System:         systemPrompt,
+		Context: ContextOptions{
+			Window:    *contextWindow,
+			Threshold: *compactAt,
+			KeepTurns: *keepTurns,
+		},
+		Output:        progress,
+		JSONOutput:    jsonEvents,
+		Quiet:         *quiet,
+		DryRun:        *dryRun,
+		DryRunReads:   *dryRunReads,
+		AuditFile:     *auditFile,
+		Backup:        *backup,
+		Redact:        *redact,
+		MaxReadSize:   *maxReadSize,
+		Goimports:     *goimports,
+		ShowThinking:  *showThinking,
+		MaxToolRounds: *maxToolRounds,
+		CountTokens:   *countTokens,
+	})
 	if err != nil {
 		errorColor.Printf("Failed to create agent: %v\n", err)
 		os.Exit(1)
 	}
 
-	p, err := NewPrompt(DefaultHistoryFile())
+	// The diff viewer can also be set with HALU_DIFF in ~/.halu.env, which is
+	// loaded by NewAgent
+	diffCommand = *diff
+	if diffCommand == "" {
+		diffCommand = os.Getenv("HALU_DIFF")
+	}
+
+	// goimports can also be enabled with HALU_GOIMPORTS=1 in ~/.halu.env,
+	// which is loaded by NewAgent
+	if enabled, _ := strconv.ParseBool(os.Getenv("HALU_GOIMPORTS")); enabled {
+		agent.goimports = true
+	}
+	if agent.goimports {
+		if _, err := exec.LookPath("goimports"); err != nil {
+			errorColor.Printf("goimports not found, install it with go install golang.org/x/tools/cmd/goimports@latest\n")
+			os.Exit(1)
+		}
+	}
+
+	if subcommand == "mcp" {
+		serveMCP(agent, os.Stdin, stdout)
+		agent.Close()
+		return
+	}
+	if subcommand == "serve" {
+		err := serve(agent, *addr)
+		agent.Close()
+		errorColor.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	if batch {
+		var code int
+		if *countOnly {
+			code = runCount(ctx, agent, stdout, *prompt, jsonEvents)
+		} else {
+			code = runBatch(ctx, agent, stdout, *prompt, jsonEvents)
+		}
+		agent.Close()
+		os.Exit(code)
+	}
+	defer agent.Close()
+
+	// vi mode can also be enabled with HALU_VI=1 in ~/.halu.env, which is
+	// loaded by NewAgent
+	viMode, _ := strconv.ParseBool(os.Getenv("HALU_VI"))
+	p, err := NewPrompt(PromptOptions{
+		HistoryFile:  DefaultHistoryFile(),
+		HistoryLimit: *historyLimit,
+		ViMode:       *vi || viMode,
+	})
 	if err != nil {
 		errorColor.Printf("Failed to create prompt: %v\n", err)
 		os.Exit(1)
 	}
 	defer p.Close()
 
-	ctx := context.Background()
-	var messages []anthropic.MessageParam
-	var totalInputTokens, totalOutputTokens int64
+	var messages []glad.Message
+	var totalUsage TokenUsage
 
 	// Main conversation loop
 	for {
@@ -321,8 +679,35 @@ func main() {
 			errorColor.Printf("Failed to save history: %v\n", err)
 		}
 
+		// Commands are handled locally and don't cost tokens, apart from /compact
+		newMessages, tokenUsage, handled, err := agent.runSlashCommand(ctx, input, messages)
+		if handled {
+			totalUsage = totalUsage.add(tokenUsage)
+			if err != nil {
+				errorColor.Printf("%s\n", err)
+			}
+			messages = newMessages
+			fmt.Println()
+			continue
+		}
+
+		// Files referenced as @path are sent along with the prompt
+		input, warnings := agent.expandMentions(input)
+		for _, warning := range warnings {
+			errorColor.Printf("%s\n", warning)
+		}
+
+		// The conversation doesn't move on when only counting
+		if *countOnly {
+			if err := printCount(ctx, agent, os.Stdout, input, messages, false); err != nil {
+				errorColor.Printf("%s\n", err)
+			}
+			fmt.Println()
+			continue
+		}
+
 		// Run with the input
-		_, newMessages, tokenUsage, err := agent.Run(ctx, input, messages)
+		_, newMessages, tokenUsage, err = agent.Run(ctx, input, messages)
 		if err != nil {
 			errorColor.Printf("%s\n", err)
 			continue
@@ -332,24 +717,57 @@ func main() {
 		messages = newMessages
 
 		// Update and display total token usage
-		totalInputTokens += tokenUsage.InputTokens
-		totalOutputTokens += tokenUsage.OutputTokens
-		
-		// Calculate costs (Claude pricing: $3/M for input, $15/M for output)
-		inputCost := float64(tokenUsage.InputTokens) * 0.000003
-		outputCost := float64(tokenUsage.OutputTokens) * 0.000015
-		totalCost := inputCost + outputCost
-		
-		totalInputCost := float64(totalInputTokens) * 0.000003
-		totalOutputCost := float64(totalOutputTokens) * 0.000015
-		totalSessionCost := totalInputCost + totalOutputCost
-		
-		tokenColor.Printf("\n⚙ Token usage summary:\n")
-		tokenColor.Printf("   - This interaction: %d input ($%.4f), %d output ($%.4f) tokens, total cost: $%.4f\n", 
-			tokenUsage.InputTokens, inputCost, tokenUsage.OutputTokens, outputCost, totalCost)
-		tokenColor.Printf("   - Total session: %d input ($%.4f), %d output ($%.4f) tokens, total cost: $%.4f\n", 
-			totalInputTokens, totalInputCost, totalOutputTokens, totalOutputCost, totalSessionCost)
+		totalUsage = totalUsage.add(tokenUsage)
+		agent.output.Summary(tokenUsage, totalUsage)
 
 		fmt.Println()
 	}
 }
+
+// runBatch runs a single prompt without the interactive prompt. Progress is
+// rendered to stderr so out only carries the final response, unless JSON
+// events are requested. It returns the process exit code.
+func runBatch(ctx context.Context, agent *Agent, out io.Writer, prompt string, jsonEvents bool) int {
+	response, _, tokenUsage, err := agent.Run(ctx, prompt, nil)
+	if err != nil {
+		if jsonEvents {
+			json.NewEncoder(out).Encode(map[string]interface{}{"type": "error", "error": err.Error()})
+		} else {
+			errorColor.Fprintf(os.Stderr, "%s\n", err)
+		}
+		return 1
+	}
+	agent.output.Summary(tokenUsage, tokenUsage)
+	if !jsonEvents {
+		fmt.Fprintln(out, response)
+	}
+	return 0
+}
+
+// printCount prints the input tokens and cost the prompt would take to out
+func printCount(ctx context.Context, agent *Agent, out io.Writer, prompt string, messages []glad.Message, jsonEvents bool) error {
+	tokens, err := agent.CountTokens(ctx, prompt, messages)
+	if err != nil {
+		return err
+	}
+	usage := TokenUsage{InputTokens: tokens}
+	if jsonEvents {
+		return json.NewEncoder(out).Encode(map[string]interface{}{"type": "count", "input_tokens": tokens, "cost": usage.inputCost()})
+	}
+	tokenColor.Fprintf(out, "⚙ %d input tokens, $%.4f\n", tokens, usage.inputCost())
+	return nil
+}
+
+// runCount prints the count for --count-only in batch mode and returns the
+// process exit code
+func runCount(ctx context.Context, agent *Agent, out io.Writer, prompt string, jsonEvents bool) int {
+	if err := printCount(ctx, agent, out, prompt, nil, jsonEvents); err != nil {
+		if jsonEvents {
+			json.NewEncoder(out).Encode(map[string]interface{}{"type": "error", "error": err.Error()})
+		} else {
+			errorColor.Fprintf(os.Stderr, "%s\n", err)
+		}
+		return 1
+	}
+	return 0
+}
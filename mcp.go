@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// mcpProtocolVersions are the Model Context Protocol revisions the server
+// speaks, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpServer exposes the agent's tools to MCP clients such as editors
+type mcpServer struct {
+	agent *Agent
+}
+
+// serveMCP serves the agent's tools over MCP with newline delimited JSON-RPC
+// on in and out until the client disconnects. Tool calls run one at a time,
+// like they do for the model.
+func serveMCP(agent *Agent, in io.ReadCloser, out io.WriteCloser) {
+	s := &mcpServer{agent: agent}
+	rwc := &streamReadWriteCloser{stdin: out, stdout: in}
+	conn := jsonrpc2.NewConn(context.Background(), jsonrpc2.NewPlainObjectStream(rwc), jsonrpc2.HandlerWithError(s.handle))
+	<-conn.DisconnectNotify()
+}
+
+func (s *mcpServer) handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if req.Params != nil {
+			json.Unmarshal(*req.Params, &params)
+		}
+		// Answer with the client's version if it is known, else the newest
+		version := mcpProtocolVersions[0]
+		for _, v := range mcpProtocolVersions {
+			if v == params.ProtocolVersion {
+				version = v
+			}
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{
+				"name":    "halu",
+				"version": "0.1.0",
+			},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools()}, nil
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if req.Params == nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "missing params"}
+		}
+		if err := json.Unmarshal(*req.Params, &params); err != nil {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+		}
+		if _, ok := s.agent.tools[params.Name]; !ok {
+			return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "unknown tool: " + params.Name}
+		}
+		if params.Arguments == nil {
+			params.Arguments = make(map[string]interface{})
+		}
+
+		// Tool failures are results the client's model should see, not
+		// protocol errors
+		result, err := s.agent.executeTool(params.Name, params.Arguments)
+		if err != nil {
+			result = err.Error()
+		}
+		isError := err != nil || strings.HasPrefix(result, toolFailedPrefix)
+		return map[string]interface{}{
+			"content": []map[string]interface{}{{"type": "text", "text": result}},
+			"isError": isError,
+		}, nil
+	}
+
+	// Notifications like notifications/initialized need no answer
+	if req.Notif {
+		return nil, nil
+	}
+	return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+// tools describes the registered tools for tools/list, sorted by name
+func (s *mcpServer) tools() []map[string]interface{} {
+	var names []string
+	for name := range s.agent.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var tools []map[string]interface{}
+	for _, name := range names {
+		tool := s.agent.tools[name]
+		tools = append(tools, map[string]interface{}{
+			"name":        tool.Name,
+			"description": tool.Description,
+			"inputSchema": tool.InputSchema,
+			"annotations": map[string]interface{}{
+				"readOnlyHint": !tool.Writes,
+			},
+		})
+	}
+	return tools
+}
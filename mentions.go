@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// maxMentionSize bounds the size of a file included with @path
+const maxMentionSize = 100 * 1024
+
+// mentionPattern matches @path tokens at the start of the input or after
+// whitespace, so email addresses aren't taken for files
+var mentionPattern = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// expandMentions appends the contents of the files referenced as @path in the
+// input, saving the model a read_file call. Tokens that aren't files are left
+// alone. Files the tools may not access, binary files and files over
+// maxMentionSize are skipped with a warning.
+func (a *Agent) expandMentions(input string) (string, []string) {
+	var contents strings.Builder
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		// Allow "look at @main.go." and "(see @main.go)"
+		path := strings.TrimRight(match[2], ".,;:!?)'\"")
+		if path == "" || seen[path] {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		seen[path] = true
+
+		switch {
+		case !a.isPathSafe(path):
+			warnings = append(warnings, fmt.Sprintf("not including @%s, it is outside the allowed directories", path))
+			continue
+		case info.Size() > maxMentionSize:
+			warnings = append(warnings, fmt.Sprintf("not including @%s, it is larger than %d KB", path, maxMentionSize/1024))
+			continue
+		case isBinaryFile(path):
+			warnings = append(warnings, fmt.Sprintf("not including @%s, it is a binary file", path))
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("not including @%s: %v", path, err))
+			continue
+		}
+		// Sent like a read_file result, so masked the same way
+		text := string(content)
+		if a.redact {
+			text = redactSecrets(text)
+		}
+		fmt.Fprintf(&contents, "\n\nContents of %s:\n```\n%s", path, text)
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			contents.WriteString("\n")
+		}
+		contents.WriteString("```")
+	}
+	return input + contents.String(), warnings
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Output receives everything the agent renders while running, keeping the
+// presentation separate from the model transport and the tools
+type Output struct {
+	Text       func(text string)                                              // streamed model text
+	Thinking   func(text string)                                              // streamed model reasoning, with --show-thinking
+	ToolCall   func(name string, input map[string]interface{})                // a tool is about to run
+	Working    func(name string) (stop func())                                // a tool is running until stop is called
+	ToolError  func(name string, err error)                                   // a tool failed
+	ToolResult func(name string, result string)                               // a tool returned
+	Usage      func(usage TokenUsage)                                         // tokens used by one step
+	Retry      func(attempt, maxAttempts int, delay time.Duration, err error) // a failed request is retried
+	Notice     func(text string)                                              // informational message
+	Diff       func(path, originalPath, proposedPath string)                  // changes to path before they are applied
+	Done       func(response string)                                          // the model finished its turn
+	Summary    func(turn, total TokenUsage)                                   // usage of the turn and the session
+}
+
+// terminalOutput renders to the terminal with colors
+func terminalOutput(w io.Writer) Output {
+	// Streamed text doesn't end in a newline, so end the line before
+	// printing anything else
+	pendingLine, thinking := false, false
+	endText := func() {
+		if pendingLine {
+			fmt.Fprintln(w)
+			pendingLine = false
+		}
+		thinking = false
+	}
+
+	return Output{
+		Text: func(text string) {
+			// The reply starts below the reasoning
+			if thinking {
+				endText()
+				fmt.Fprintln(w)
+			}
+			fmt.Fprint(w, text)
+			pendingLine = true
+		},
+		Thinking: func(text string) {
+			if !thinking {
+				endText()
+				thinking = true
+			}
+			thinkingColor.Fprint(w, text)
+			pendingLine = true
+		},
+		ToolCall: func(name string, input map[string]interface{}) {
+			endText()
+
+			// Print tool call with input parameters
+			inputStr := prettyPrint(input)
+
+			// For write_file, ensure the path is always shown in the debug output
+			if path, ok := input["path"].(string); name == "write_file" && ok {
+				if len(inputStr) > 100 {
+					toolColor.Fprintf(w, "\n➤ tool: %s(path: %s, content: [truncated])\n", name, path)
+				} else {
+					toolColor.Fprintf(w, "\n➤ tool: %s(%s)\n", name, inputStr)
+				}
+			} else {
+				// Default behavior for other tools
+				if len(inputStr) > 100 {
+					inputStr = inputStr[:97] + "..."
+				}
+				toolColor.Fprintf(w, "\n➤ tool: %s(%s)\n", name, inputStr)
+			}
+		},
+		Working: func(name string) func() {
+			return startSpinner(w, "running "+name)
+		},
+		ToolError: func(name string, err error) {
+			errorColor.Fprintf(w, "➤ Tool execution failed: %v\n", err)
+		},
+		ToolResult: func(name string, result string) {},
+		Usage: func(usage TokenUsage) {
+			endText()
+			if usage.CacheCreationTokens > 0 || usage.CacheReadTokens > 0 {
+				tokenColor.Fprintf(w, "\n⚙ used %d input, %d output tokens, %d cache read, %d cache write\n",
+					usage.InputTokens, usage.OutputTokens, usage.CacheReadTokens, usage.CacheCreationTokens)
+			} else {
+				tokenColor.Fprintf(w, "\n⚙ used %d input, %d output tokens\n", usage.InputTokens, usage.OutputTokens)
+			}
+		},
+		Retry: func(attempt, maxAttempts int, delay time.Duration, err error) {
+			endText()
+			fmt.Fprintf(w, "\n[Retrying in %s due to streaming error %s... Attempt %d/%d]\n", delay.Round(100*time.Millisecond), err, attempt+1, maxAttempts)
+		},
+		Notice: func(text string) {
+			endText()
+			stepColor.Fprintf(w, "\n➤ %s\n", text)
+		},
+		Diff: func(path, originalPath, proposedPath string) {
+			endText()
+			fmt.Fprintln(w, "\nShowing diff between original and proposed changes...")
+			showDiff(w, path, originalPath, proposedPath)
+		},
+		Done: func(response string) {
+			endText()
+			stepColor.Fprintln(w, "\n➤ done")
+		},
+		Summary: func(turn, total TokenUsage) {
+			// Costs follow Claude pricing, see TokenUsage
+			tokenColor.Fprintf(w, "\n⚙ Token usage summary:\n")
+			tokenColor.Fprintf(w, "   - This interaction: %d input ($%.4f), %d output ($%.4f) tokens, total cost: $%.4f\n",
+				turn.InputTokens, turn.inputCost(), turn.OutputTokens, turn.outputCost(), turn.cost())
+			if turn.CacheCreationTokens > 0 || turn.CacheReadTokens > 0 {
+				tokenColor.Fprintf(w, "     cache: %d written ($%.4f), %d read ($%.4f), saved $%.4f\n",
+					turn.CacheCreationTokens, turn.cacheWriteCost(), turn.CacheReadTokens, turn.cacheReadCost(), turn.cacheSavings())
+			}
+			tokenColor.Fprintf(w, "   - Total session: %d input ($%.4f), %d output ($%.4f) tokens, total cost: $%.4f\n",
+				total.InputTokens, total.inputCost(), total.OutputTokens, total.outputCost(), total.cost())
+			if total.CacheCreationTokens > 0 || total.CacheReadTokens > 0 {
+				tokenColor.Fprintf(w, "     cache: %d written ($%.4f), %d read ($%.4f), saved $%.4f\n",
+					total.CacheCreationTokens, total.cacheWriteCost(), total.CacheReadTokens, total.cacheReadCost(), total.cacheSavings())
+			}
+		},
+	}
+}
+
+// quietOutput keeps only the streamed text of out and replaces the usage
+// summary with a single line, for --quiet
+func quietOutput(out Output, w io.Writer) Output {
+	// Text of separate steps goes on separate lines
+	pendingLine := false
+	endText := func() {
+		if pendingLine {
+			fmt.Fprintln(w)
+			pendingLine = false
+		}
+	}
+
+	return Output{
+		Text: func(text string) {
+			out.Text(text)
+			pendingLine = true
+		},
+		Thinking:   func(text string) {},
+		ToolCall:   func(name string, input map[string]interface{}) { endText() },
+		Working:    func(name string) func() { return func() {} },
+		ToolError:  func(name string, err error) {},
+		ToolResult: func(name string, result string) {},
+		Usage:      func(usage TokenUsage) {},
+		Retry:      func(attempt, maxAttempts int, delay time.Duration, err error) {},
+		Notice:     func(text string) {},
+		Diff:       out.Diff, // needed to confirm changes
+		Done:       func(response string) { endText() },
+		Summary: func(turn, total TokenUsage) {
+			tokenColor.Fprintf(w, "⚙ %d input, %d output tokens, $%.4f\n",
+				turn.InputTokens+turn.CacheCreationTokens+turn.CacheReadTokens, turn.OutputTokens, turn.cost())
+		},
+	}
+}
+
+// jsonOutput writes newline delimited JSON events for machine consumption
+func jsonOutput(w io.Writer) Output {
+	encoder := json.NewEncoder(w)
+	return eventOutput(func(event map[string]interface{}) {
+		encoder.Encode(event)
+	})
+}
+
+// eventOutput passes everything rendered to emit as events with a "type"
+func eventOutput(emit func(event map[string]interface{})) Output {
+	return Output{
+		Text: func(text string) {
+			emit(map[string]interface{}{"type": "text", "text": text})
+		},
+		Thinking: func(text string) {
+			emit(map[string]interface{}{"type": "thinking", "text": text})
+		},
+		ToolCall: func(name string, input map[string]interface{}) {
+			emit(map[string]interface{}{"type": "tool_call", "name": name, "input": input})
+		},
+		Working: func(name string) func() {
+			return func() {}
+		},
+		ToolError: func(name string, err error) {
+			emit(map[string]interface{}{"type": "tool_error", "name": name, "error": err.Error()})
+		},
+		ToolResult: func(name string, result string) {
+			emit(map[string]interface{}{"type": "tool_result", "name": name, "result": result})
+		},
+		Usage: func(usage TokenUsage) {
+			emit(map[string]interface{}{
+				"type":                        "usage",
+				"input_tokens":                usage.InputTokens,
+				"output_tokens":               usage.OutputTokens,
+				"cache_creation_input_tokens": usage.CacheCreationTokens,
+				"cache_read_input_tokens":     usage.CacheReadTokens,
+			})
+		},
+		Retry: func(attempt, maxAttempts int, delay time.Duration, err error) {
+			emit(map[string]interface{}{"type": "retry", "attempt": attempt + 1, "max_attempts": maxAttempts, "delay_ms": delay.Milliseconds(), "error": err.Error()})
+		},
+		Notice: func(text string) {
+			emit(map[string]interface{}{"type": "notice", "text": text})
+		},
+		Diff: func(path, originalPath, proposedPath string) {
+			original, _ := os.ReadFile(originalPath)
+			proposed, _ := os.ReadFile(proposedPath)
+			emit(map[string]interface{}{"type": "diff", "path": path, "diff": unifiedDiff("a/"+path, "b/"+path, string(original), string(proposed))})
+		},
+		Done: func(response string) {
+			emit(map[string]interface{}{"type": "done", "response": response})
+		},
+		Summary: func(turn, total TokenUsage) {
+			emit(map[string]interface{}{
+				"type":                              "summary",
+				"input_tokens":                      turn.InputTokens,
+				"output_tokens":                     turn.OutputTokens,
+				"cache_creation_input_tokens":       turn.CacheCreationTokens,
+				"cache_read_input_tokens":           turn.CacheReadTokens,
+				"cost":                              turn.cost(),
+				"total_input_tokens":                total.InputTokens,
+				"total_output_tokens":               total.OutputTokens,
+				"total_cache_creation_input_tokens": total.CacheCreationTokens,
+				"total_cache_read_input_tokens":     total.CacheReadTokens,
+				"total_cost":                        total.cost(),
+			})
+		},
+	}
+}
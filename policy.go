@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tool policies decide whether a tool call needs the user's approval
+const (
+	policyAuto    = "auto"    // run without asking, writes apply directly
+	policyConfirm = "confirm" // ask first, writes always show the diff for approval
+	policyDeny    = "deny"    // never run
+)
+
+// parseToolPolicy parses a policy like "write_file=confirm,go_vet=auto,*=deny"
+// where "*" applies to every tool without an entry of its own. Entries may
+// be separated by commas or whitespace.
+func parseToolPolicy(spec string) (map[string]string, error) {
+	policy := make(map[string]string)
+	for _, entry := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid tool policy entry %q, expected tool=policy", entry)
+		}
+		switch value {
+		case policyAuto, policyConfirm, policyDeny:
+			policy[name] = value
+		default:
+			return nil, fmt.Errorf("invalid tool policy %q for %s, expected auto, confirm or deny", value, name)
+		}
+	}
+	return policy, nil
+}
+
+// toolPolicy returns the policy for a tool, or an empty string if none is
+// configured and the default behavior applies
+func (a *Agent) toolPolicy(name string) string {
+	if policy, ok := a.policy[name]; ok {
+		return policy
+	}
+	return a.policy["*"]
+}
+
+// autoApply reports whether the running tool's writes apply without
+// confirmation. The tool's policy takes precedence over --yolo.
+func (a *Agent) autoApply() bool {
+	switch a.activePolicy {
+	case policyAuto:
+		return true
+	case policyConfirm:
+		return false
+	}
+	return a.yolo
+}
+
+// writeOptions returns how the running tool's writes are applied
+func (a *Agent) writeOptions() writeOptions {
+	return writeOptions{Yolo: a.autoApply(), Backup: a.backup, Preview: a.output.Diff}
+}
@@ -15,9 +15,31 @@ import (
 type Prompt struct {
 	rl      *readline.Instance
 	history string
+	limit   int    // maximum number of history entries kept
+	last    string // most recent history entry, to skip repeats
 }
 
-func NewPrompt(historyFile string) (*Prompt, error) {
+// historyNewline stands in for newlines so a multi-line prompt is stored,
+// recalled and edited as a single history entry
+const historyNewline = "␤"
+
+// DefaultHistoryLimit is the number of history entries kept unless configured
+const DefaultHistoryLimit = 1000
+
+// PromptOptions configures a new Prompt
+type PromptOptions struct {
+	HistoryFile  string // file the input history is kept in
+	HistoryLimit int    // maximum number of history entries kept, 0 for DefaultHistoryLimit
+	ViMode       bool   // use vi key bindings instead of emacs ones
+}
+
+func NewPrompt(opts PromptOptions) (*Prompt, error) {
+	historyFile := opts.HistoryFile
+	limit := opts.HistoryLimit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+
 	// Ensure history directory exists
 	historyDir := filepath.Dir(historyFile)
 	if err := os.MkdirAll(historyDir, 0755); err != nil {
@@ -29,17 +51,29 @@ func NewPrompt(historyFile string) (*Prompt, error) {
 		Prompt:            color.GreenString("➤ "),
 		HistoryFile:       historyFile,
 		HistorySearchFold: true,
+		HistoryLimit:      limit,
 		InterruptPrompt:   "^C",
 		EOFPrompt:         "ok",
+		AutoComplete:      completer{},
+		VimMode:           opts.ViMode,
+
+		// History is saved by AddToHistory, which skips repeats and the
+		// end of input marker
+		DisableAutoSaveHistory: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create readline instance: %v", err)
 	}
 
-	return &Prompt{
+	p := &Prompt{
 		rl:      rl,
 		history: historyFile,
-	}, nil
+		limit:   limit,
+	}
+	if history, err := p.LoadHistory(); err == nil && len(history) > 0 {
+		p.last = history[len(history)-1]
+	}
+	return p, nil
 }
 
 // GetMultiLineInput reads input from the user, treating either a single "."
@@ -72,6 +106,9 @@ func (p *Prompt) GetMultiLineInput() (string, error) {
 		// Trim trailing whitespace but preserve leading whitespace
 		line = strings.TrimRight(line, " \t")
 
+		// A recalled multi-line entry expands back into its lines
+		line = strings.ReplaceAll(line, historyNewline, "\n")
+
 		// Single dot on a line marks the end of input
 		if line == "." {
 			break
@@ -91,14 +128,39 @@ func (p *Prompt) GetMultiLineInput() (string, error) {
 	return strings.Join(lines, "\n"), nil
 }
 
-// AddToHistory adds a line to the history file
+// AddToHistory adds the input to the history file as a single entry, skipping
+// blank input and repeats of the previous entry, and drops the oldest
+// entries once the file exceeds the history limit
 func (p *Prompt) AddToHistory(input string) error {
-	// Split multi-line input and add each line to history
-	lines := strings.Split(input, "\n")
-	for _, line := range lines {
-		p.rl.SaveHistory(line)
+	if strings.TrimSpace(input) == "" {
+		return nil
+	}
+	entry := strings.ReplaceAll(input, "\n", historyNewline)
+	if entry == p.last {
+		return nil
+	}
+	if err := p.rl.SaveHistory(entry); err != nil {
+		return err
+	}
+	p.last = entry
+	return p.trimHistory()
+}
+
+// trimHistory keeps the newest entries of the history file up to the limit.
+// The file is rewritten in place since readline keeps it open for appending.
+func (p *Prompt) trimHistory() error {
+	history, err := p.LoadHistory()
+	if err != nil || len(history) <= p.limit {
+		return err
+	}
+
+	var kept []string
+	for _, line := range history[len(history)-p.limit:] {
+		if len(kept) == 0 || kept[len(kept)-1] != line {
+			kept = append(kept, line)
+		}
 	}
-	return nil
+	return os.WriteFile(p.history, []byte(strings.Join(kept, "\n")+"\n"), 0600)
 }
 
 // LoadHistory loads the command history into memory
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"regexp"
+)
+
+// privateKeyBlock matches a whole PEM private key, so none of it is sent
+var privateKeyBlock = regexp.MustCompile(`(?s)-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----.*?-----END ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`)
+
+// Values of password and secret keys are masked however guessable, but only
+// where they are values: quoted literals like password = "correct horse",
+// .env lines like DB_PASSWORD=hunter2 and URL queries like ?pwd=hunter2.
+// Code like pwd := os.Getwd() or if password == "" is left alone.
+var (
+	redactPassword      = regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret)\w*["']?\s*(?::=|=|:)\s*)("[^"\n]+"|'[^'\n]+')`)
+	redactEnvPassword   = regexp.MustCompile(`(?im)^((?:export[ \t]+)?\w*(?:password|passwd|pwd|secret)\w*=)([^\s"']\S*)`)
+	redactQueryPassword = regexp.MustCompile(`(?i)([?&]\w*(?:password|passwd|pwd|secret)\w*=)([^\s"'&#]+)`)
+)
+
+// redactAssignment matches values assigned to other suspiciously named keys,
+// quoted or not, like api_key=... in a .env file or a URL
+var redactAssignment = regexp.MustCompile(`(?i)((?:token|api_?key|access_?key|private_?key|credential)\w*["']?\s*(?::=|=|:)\s*["']?)([^"'\s,;&()\[\]{}<>]{8,})`)
+
+// redactSecrets masks the secrets secret_scan looks for, for --redact.
+// Password and secret values are always masked, however guessable. Like
+// secret_scan, values of token and key names are only masked when they look
+// random, so code like token := parseToken(s) stays readable.
+func redactSecrets(text string) string {
+	text = privateKeyBlock.ReplaceAllString(text, "[REDACTED private_key]")
+	for _, sp := range secretPatterns {
+		text = sp.Pattern.ReplaceAllString(text, "[REDACTED "+sp.Kind+"]")
+	}
+	text = redactPassword.ReplaceAllStringFunc(text, func(match string) string {
+		m := redactPassword.FindStringSubmatch(match)
+		quote := m[2][:1]
+		return m[1] + quote + "[REDACTED]" + quote
+	})
+	text = redactEnvPassword.ReplaceAllString(text, "${1}[REDACTED]")
+	text = redactQueryPassword.ReplaceAllString(text, "${1}[REDACTED]")
+	return redactAssignment.ReplaceAllStringFunc(text, func(match string) string {
+		m := redactAssignment.FindStringSubmatch(match)
+		if shannonEntropy(m[2]) < 3.5 {
+			return match
+		}
+		return m[1] + "[REDACTED]"
+	})
+}
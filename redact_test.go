@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"env password", "password=supersecret", "password=[REDACTED]"},
+		{"env prefixed key", "DB_PASSWORD=hunter2", "DB_PASSWORD=[REDACTED]"},
+		{"env export", "export SECRET=hunter2", "export SECRET=[REDACTED]"},
+		{"quoted with spaces", `password = "correct horse"`, `password = "[REDACTED]"`},
+		{"single quoted", "secret: 'hunter2'", "secret: '[REDACTED]'"},
+		{"json", `{"password": "hunter2"}`, `{"password": "[REDACTED]"}`},
+		{"url query", "https://example.com/login?user=bob&pwd=hunter2&next=1", "https://example.com/login?user=bob&pwd=[REDACTED]&next=1"},
+		{"call", "pwd := os.Getwd()", "pwd := os.Getwd()"},
+		{"comparison", `if password == "" {`, `if password == "" {`},
+		{"not equal", `if secret != "x" {`, `if secret != "x" {`},
+		{"struct field", "\tSecret: true,", "\tSecret: true,"},
+		{"identifier", "\tpassword = readPassword()", "\tpassword = readPassword()"},
+		{"empty literal", `password := ""`, `password := ""`},
+		{"guessable token", "token := parseToken(s)", "token := parseToken(s)"},
+		{"random api key", "api_key=Xk29fjQ8zLm3Pq7w", "api_key=[REDACTED]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactSecrets(tt.text); got != tt.want {
+				t.Errorf("redactSecrets(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"halu/glad"
+)
+
+// session is a conversation held by the server
+type session struct {
+	messages      []glad.Message
+	contextTokens int64
+	usage         TokenUsage
+}
+
+// server exposes the agent over HTTP. Prompts stream their progress back as
+// Server-Sent Events carrying the same events as --output json.
+type server struct {
+	agent *Agent
+	token string // bearer token every request has to present
+
+	// The agent renders to one output and tracks one context at a time, so
+	// prompts run one after another even across sessions
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newServer(agent *Agent, token string) *server {
+	return &server{agent: agent, token: token, sessions: make(map[string]*session)}
+}
+
+// handler routes
+//
+//	POST   /sessions/{id}/prompt  run {"prompt": "..."} in the session
+//	DELETE /sessions/{id}         forget the session
+//
+// Sessions are created by their first prompt. Every request needs the
+// server's bearer token, see authorize.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sessions/{id}/prompt", s.handlePrompt)
+	mux.HandleFunc("DELETE /sessions/{id}", s.handleDelete)
+	return s.authorize(mux)
+}
+
+// authorize guards the handler against other programs and web pages. The
+// agent spends API credits and may write files, so a request has to come
+// for a loopback host, so DNS rebinding can't reach it, carry no foreign
+// Origin, so pages in a browser can't drive it, and present the token.
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			http.Error(w, "host not allowed", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !isLoopbackHost(u.Host) {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or wrong bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost reports whether a host, with or without a port, names the
+// local machine
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *server) handlePrompt(w http.ResponseWriter, r *http.Request) {
+	// Browsers send other content types cross-origin without a preflight
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var body struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.Prompt) == "" {
+		http.Error(w, "prompt is required", http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	sess := s.sessions[id]
+	if sess == nil {
+		sess = &session{}
+		s.sessions[id] = sess
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	emit := func(event map[string]interface{}) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event["type"], data)
+		flusher.Flush()
+	}
+
+	output := s.agent.output
+	s.agent.output = eventOutput(emit)
+	s.agent.contextTokens = sess.contextTokens
+	defer func() { s.agent.output = output }()
+
+	// A client that disconnects cancels its prompt
+	_, messages, usage, err := s.agent.Run(r.Context(), body.Prompt, sess.messages)
+	sess.usage = sess.usage.add(usage)
+	if err != nil {
+		emit(map[string]interface{}{"type": "error", "error": err.Error()})
+		return
+	}
+	sess.messages = messages
+	sess.contextTokens = s.agent.contextTokens
+	s.agent.output.Summary(usage, sess.usage)
+}
+
+func (s *server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.sessions[id]; !ok {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	delete(s.sessions, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serve runs the HTTP server on addr until it fails. Clients authenticate
+// with a token made for this run, printed at startup.
+func serve(agent *Agent, addr string) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("error creating token: %v", err)
+	}
+	token := hex.EncodeToString(secret)
+	log.Printf("Serving on http://%s, authenticate with the header Authorization: Bearer %s", addr, token)
+	return http.ListenAndServe(addr, newServer(agent, token).handler())
+}
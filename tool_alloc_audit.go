@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+)
+
+type AllocFinding struct {
+	Location   string `json:"location"`
+	Function   string `json:"function"`
+	Kind       string `json:"kind"`
+	Detail     string `json:"detail"`
+	Suggestion string `json:"suggestion"`
+}
+
+func isStringType(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsString != 0
+}
+
+func isByteSlice(t types.Type) bool {
+	slice, ok := t.Underlying().(*types.Slice)
+	if !ok {
+		return false
+	}
+	basic, ok := slice.Elem().Underlying().(*types.Basic)
+	return ok && basic.Kind() == types.Byte
+}
+
+// unsizedSlices returns the slice variables in body that are declared without
+// a capacity, e.g. "var x []T", "x := []T{}" or "x := make([]T, 0)"
+func unsizedSlices(body *ast.BlockStmt, info *types.Info) map[types.Object]bool {
+	slices := make(map[types.Object]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			if len(n.Values) > 0 {
+				return true
+			}
+			for _, name := range n.Names {
+				if obj := info.Defs[name]; obj != nil {
+					if _, ok := obj.Type().Underlying().(*types.Slice); ok {
+						slices[obj] = true
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			if n.Tok != token.DEFINE || len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, rhs := range n.Rhs {
+				ident, ok := n.Lhs[i].(*ast.Ident)
+				if !ok {
+					continue
+				}
+				obj := info.Defs[ident]
+				if obj == nil {
+					continue
+				}
+				switch r := rhs.(type) {
+				case *ast.CompositeLit:
+					if _, ok := obj.Type().Underlying().(*types.Slice); ok && len(r.Elts) == 0 {
+						slices[obj] = true
+					}
+				case *ast.CallExpr:
+					if fn, ok := r.Fun.(*ast.Ident); ok && fn.Name == "make" && len(r.Args) == 2 {
+						if lit, ok := r.Args[1].(*ast.BasicLit); ok && lit.Value == "0" {
+							slices[obj] = true
+						}
+					}
+				}
+			}
+		}
+		return true
+	})
+	return slices
+}
+
+// auditAllocs scans a function body for allocation-heavy patterns
+func auditAllocs(fset *token.FileSet, info *types.Info, fd *ast.FuncDecl) []AllocFinding {
+	var findings []AllocFinding
+	name := funcDeclName(fd)
+	add := func(pos token.Pos, kind, detail, suggestion string) {
+		findings = append(findings, AllocFinding{
+			Location:   positionString(fset, pos),
+			Function:   name,
+			Kind:       kind,
+			Detail:     detail,
+			Suggestion: suggestion,
+		})
+	}
+
+	slices := unsizedSlices(fd.Body, info)
+	reported := make(map[types.Object]bool)
+
+	var visit func(n ast.Node, inLoop bool)
+	visit = func(n ast.Node, inLoop bool) {
+		ast.Inspect(n, func(c ast.Node) bool {
+			switch c := c.(type) {
+			case *ast.ForStmt:
+				visit(c.Body, true)
+				return false
+			case *ast.RangeStmt:
+				visit(c.Body, true)
+				return false
+			case *ast.FuncLit:
+				visit(c.Body, false)
+				return false
+
+			case *ast.AssignStmt:
+				if !inLoop || len(c.Lhs) != 1 || len(c.Rhs) != 1 {
+					return true
+				}
+				lhsType := info.TypeOf(c.Lhs[0])
+				if lhsType == nil || !isStringType(lhsType) {
+					return true
+				}
+				lhs := types.ExprString(c.Lhs[0])
+				if c.Tok == token.ADD_ASSIGN {
+					add(c.Pos(), "string_concat_in_loop", lhs+" += ... inside a loop",
+						"build the string with a strings.Builder and call String() once after the loop")
+				} else if bin, ok := c.Rhs[0].(*ast.BinaryExpr); ok && c.Tok == token.ASSIGN && bin.Op == token.ADD && types.ExprString(bin.X) == lhs {
+					add(c.Pos(), "string_concat_in_loop", lhs+" = "+lhs+" + ... inside a loop",
+						"build the string with a strings.Builder and call String() once after the loop")
+				}
+
+			case *ast.CallExpr:
+				if fn, ok := c.Fun.(*ast.Ident); ok && fn.Name == "append" && inLoop && len(c.Args) > 0 {
+					ident, ok := c.Args[0].(*ast.Ident)
+					if !ok {
+						return true
+					}
+					obj := info.Uses[ident]
+					if obj != nil && slices[obj] && !reported[obj] {
+						reported[obj] = true
+						add(c.Pos(), "append_without_prealloc", "append to "+ident.Name+" in a loop, declared without capacity",
+							fmt.Sprintf("preallocate with make(%s, 0, n) when the final length is known", types.TypeString(obj.Type(), types.RelativeTo(nil))))
+					}
+					return true
+				}
+
+				// Conversions between string and []byte copy their data
+				if len(c.Args) != 1 {
+					return true
+				}
+				tv, ok := info.Types[c.Fun]
+				if !ok || !tv.IsType() {
+					return true
+				}
+				argType := info.TypeOf(c.Args[0])
+				if argType == nil {
+					return true
+				}
+				toString := isStringType(tv.Type) && isByteSlice(argType)
+				toBytes := isByteSlice(tv.Type) && isStringType(argType)
+				if !toString && !toBytes {
+					return true
+				}
+				if inner, ok := c.Args[0].(*ast.CallExpr); ok {
+					if innerTV, ok := info.Types[inner.Fun]; ok && innerTV.IsType() && len(inner.Args) == 1 {
+						if origType := info.TypeOf(inner.Args[0]); origType != nil && types.Identical(origType, tv.Type) {
+							add(c.Pos(), "conversion_round_trip", types.ExprString(c)+" converts back and forth",
+								"use the original value directly")
+							return false
+						}
+					}
+				}
+				if inLoop {
+					add(c.Pos(), "conversion_in_loop", types.ExprString(c)+" copies on every iteration",
+						"convert once outside the loop, or use the bytes/strings functions that accept the original type")
+				}
+			}
+			return true
+		})
+	}
+	visit(fd.Body, false)
+
+	return findings
+}
+
+func registerAllocAuditTool(a *Agent) {
+	a.tools["alloc_audit"] = Tool{
+		Name:        "alloc_audit",
+		Description: "Heuristically find allocation-heavy patterns in Go functions: string concatenation in loops, append without preallocation, and string/[]byte conversions in loops. This is guidance, not a profiler",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file or package directory containing the function",
+				},
+				"function": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the function to audit, e.g. 'parse' or 'Agent.Run'. If omitted every function is audited",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			function, _ := input["function"].(string)
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			fset, files, err := parseGoFiles(path)
+			if err != nil {
+				return "", err
+			}
+			info := typeCheck(fset, files)
+
+			var decls []*ast.FuncDecl
+			if function != "" {
+				decls = findFuncDecls(files, function)
+				if len(decls) == 0 {
+					return "", fmt.Errorf("function %s not found in %s", function, path)
+				}
+			} else {
+				for _, file := range files {
+					for _, decl := range file.Decls {
+						if fd, ok := decl.(*ast.FuncDecl); ok {
+							decls = append(decls, fd)
+						}
+					}
+				}
+			}
+
+			findings := []AllocFinding{}
+			for _, fd := range decls {
+				if fd.Body != nil {
+					findings = append(findings, auditAllocs(fset, info, fd)...)
+				}
+			}
+
+			result, err := json.Marshal(findings)
+			return string(result), err
+		},
+	}
+}
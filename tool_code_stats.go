@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type ExtensionStats struct {
+	Extension string `json:"extension"`
+	Files     int    `json:"files"`
+	Lines     int    `json:"lines"`
+}
+
+// countLines counts the lines of a file without loading it whole. A last
+// line without a trailing newline counts too.
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 32*1024)
+	lines := 0
+	var last byte = '\n'
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			lines += bytes.Count(buf[:n], []byte("\n"))
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if last != '\n' {
+		lines++
+	}
+	return lines, nil
+}
+
+func registerCodeStatsTool(a *Agent) {
+	a.tools["code_stats"] = Tool{
+		Name:        "code_stats",
+		Description: "Count files and lines per file extension below a directory, like a tiny cloc, to gauge the size and languages of a project. Files ignored by .gitignore or .haluignore are skipped, binary files are counted separately",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The directory to count (default: .)",
+				},
+			},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, _ := input["path"].(string)
+			if path == "" {
+				path = "."
+			}
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			stats := make(map[string]*ExtensionStats)
+			totalFiles, totalLines, binaryFiles := 0, 0, 0
+			err := a.walkIgnoring(path, func(currentPath string, info os.FileInfo) error {
+				if info.IsDir() {
+					return nil
+				}
+				if isBinaryFile(currentPath) {
+					binaryFiles++
+					return nil
+				}
+				lines, err := countLines(currentPath)
+				if err != nil {
+					return nil
+				}
+
+				ext := filepath.Ext(currentPath)
+				if ext == "" {
+					ext = "(none)"
+				}
+				if stats[ext] == nil {
+					stats[ext] = &ExtensionStats{Extension: ext}
+				}
+				stats[ext].Files++
+				stats[ext].Lines += lines
+				totalFiles++
+				totalLines += lines
+				return nil
+			})
+			if err != nil {
+				return "", err
+			}
+
+			// Largest first
+			byExtension := []ExtensionStats{}
+			for _, s := range stats {
+				byExtension = append(byExtension, *s)
+			}
+			sort.Slice(byExtension, func(i, j int) bool {
+				if byExtension[i].Lines != byExtension[j].Lines {
+					return byExtension[i].Lines > byExtension[j].Lines
+				}
+				return byExtension[i].Extension < byExtension[j].Extension
+			})
+
+			result, err := json.Marshal(map[string]interface{}{
+				"files":        totalFiles,
+				"lines":        totalLines,
+				"binary_files": binaryFiles,
+				"by_extension": byExtension,
+			})
+			return string(result), err
+		},
+	}
+}
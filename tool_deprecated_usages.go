@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+)
+
+type DeprecatedUsage struct {
+	Symbol  string   `json:"symbol"`
+	Message string   `json:"message"`
+	Usages  []string `json:"usages"`
+}
+
+// deprecationMessage returns the "Deprecated:" paragraph of a doc comment,
+// or an empty string if the doc doesn't mark the symbol as deprecated
+func deprecationMessage(doc string) string {
+	for _, paragraph := range strings.Split(doc, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if strings.HasPrefix(paragraph, "Deprecated:") {
+			return strings.Join(strings.Fields(paragraph), " ")
+		}
+	}
+	return ""
+}
+
+// deprecationIndex looks up the doc comments of function declarations,
+// parsing each declaring file at most once
+type deprecationIndex struct {
+	files    map[string]map[int]string // filename -> line of the func name -> deprecation message
+	messages map[types.Object]string
+}
+
+func (d *deprecationIndex) lookup(fset *token.FileSet, obj types.Object) string {
+	if msg, ok := d.messages[obj]; ok {
+		return msg
+	}
+
+	pos := fset.Position(obj.Pos())
+	if pos.Filename == "" {
+		d.messages[obj] = ""
+		return ""
+	}
+
+	lines, ok := d.files[pos.Filename]
+	if !ok {
+		lines = make(map[int]string)
+		fileSet := token.NewFileSet()
+		if file, err := parser.ParseFile(fileSet, pos.Filename, nil, parser.ParseComments); err == nil {
+			for _, decl := range file.Decls {
+				fd, ok := decl.(*ast.FuncDecl)
+				if !ok || fd.Doc == nil {
+					continue
+				}
+				if msg := deprecationMessage(fd.Doc.Text()); msg != "" {
+					lines[fileSet.Position(fd.Name.Pos()).Line] = msg
+				}
+			}
+		}
+		d.files[pos.Filename] = lines
+	}
+
+	msg := lines[pos.Line]
+	d.messages[obj] = msg
+	return msg
+}
+
+// qualifiedFuncName returns a readable name like "io/ioutil.ReadFile" or
+// "halu.Agent.Run" for a function or method
+func qualifiedFuncName(fn *types.Func) string {
+	name := fn.Name()
+	if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+		recv := sig.Recv().Type()
+		if ptr, ok := recv.(*types.Pointer); ok {
+			recv = ptr.Elem()
+		}
+		if named, ok := recv.(*types.Named); ok {
+			name = named.Obj().Name() + "." + name
+		}
+	}
+	if fn.Pkg() != nil {
+		return fn.Pkg().Path() + "." + name
+	}
+	return name
+}
+
+func registerDeprecatedUsagesTool(a *Agent) {
+	a.tools["deprecated_usages"] = Tool{
+		Name:        "deprecated_usages",
+		Description: "Find uses of deprecated functions and methods, i.e. those whose doc comment contains a 'Deprecated:' paragraph, in local code as well as dependencies and the standard library. Results are grouped by deprecated symbol with the deprecation notice",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file or directory to scan. Directories are scanned recursively",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			fset, files, err := parseGoFiles(path)
+			if err != nil {
+				return "", err
+			}
+			info := typeCheck(fset, files)
+
+			index := &deprecationIndex{
+				files:    make(map[string]map[int]string),
+				messages: make(map[types.Object]string),
+			}
+			found := make(map[string]*DeprecatedUsage)
+			for _, file := range files {
+				ast.Inspect(file, func(n ast.Node) bool {
+					ident, ok := n.(*ast.Ident)
+					if !ok {
+						return true
+					}
+					fn, ok := info.Uses[ident].(*types.Func)
+					if !ok {
+						return true
+					}
+					// Generic instantiations share the doc of their origin
+					fn = fn.Origin()
+					msg := index.lookup(fset, fn)
+					if msg == "" {
+						return true
+					}
+
+					symbol := qualifiedFuncName(fn)
+					usage, ok := found[symbol]
+					if !ok {
+						usage = &DeprecatedUsage{Symbol: symbol, Message: msg}
+						found[symbol] = usage
+					}
+					usage.Usages = append(usage.Usages, positionString(fset, ident.Pos()))
+					return true
+				})
+			}
+
+			usages := []DeprecatedUsage{}
+			for _, usage := range found {
+				usages = append(usages, *usage)
+			}
+			sort.Slice(usages, func(i, j int) bool { return usages[i].Symbol < usages[j].Symbol })
+
+			result, err := json.Marshal(usages)
+			return string(result), err
+		},
+	}
+}
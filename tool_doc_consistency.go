@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type DocIssue struct {
+	Function string   `json:"function"`
+	Location string   `json:"location"`
+	Issues   []string `json:"issues"`
+}
+
+var (
+	// docBacktickRef matches identifiers quoted in backticks or doc links
+	docBacktickRef = regexp.MustCompile("[`\\[]([A-Za-z_][A-Za-z0-9_]*)[`\\]]")
+	// docParamRef matches phrases like "param foo:" or "the foo argument"
+	docParamRef = regexp.MustCompile(`(?i)\b(?:param(?:eter)?|arg(?:ument)?)\s+([A-Za-z_][A-Za-z0-9_]*)\s*:|\bthe\s+([A-Za-z_][A-Za-z0-9_]*)\s+(?:param(?:eter)?|arg(?:ument)?)\b`)
+	// docCodeWord matches words that look like code: camelCase or snake_case
+	docCodeWord = regexp.MustCompile(`\b([a-z]+[A-Z][A-Za-z0-9]*|[a-z]+_[a-z0-9_]+)\b`)
+	// docReturnsError matches prose promising an error result
+	docReturnsError = regexp.MustCompile(`(?i)\b(returns?\s+(an?\s+|a\s+non-nil\s+)?error|or an error)\b`)
+	// docReturnsBool matches prose promising a boolean result
+	docReturnsBool = regexp.MustCompile(`(?i)\b(reports whether|returns (true|false))\b`)
+)
+
+// checkDocConsistency compares a function's doc comment against its signature
+func checkDocConsistency(fd *ast.FuncDecl, info *types.Info) []string {
+	if fd.Doc == nil {
+		return nil
+	}
+	doc := fd.Doc.Text()
+	var issues []string
+
+	if first := strings.Fields(doc); len(first) > 0 && first[0] != fd.Name.Name && strings.TrimSuffix(first[0], "'s") != fd.Name.Name {
+		if len(first) < 2 || first[1] != fd.Name.Name {
+			issues = append(issues, fmt.Sprintf("doc comment doesn't start with the function name %s", fd.Name.Name))
+		}
+	}
+
+	known := map[string]bool{fd.Name.Name: true}
+	addFields := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				known[name.Name] = true
+			}
+		}
+	}
+	addFields(fd.Recv)
+	addFields(fd.Type.TypeParams)
+	addFields(fd.Type.Params)
+	addFields(fd.Type.Results)
+
+	// Identifiers the doc may legitimately mention: anything resolvable from
+	// the function's scope, locals used in its body, and universe names
+	isKnown := func(name string) bool {
+		if known[name] || types.Universe.Lookup(name) != nil || token.Lookup(name).IsKeyword() {
+			return true
+		}
+		if obj := info.Defs[fd.Name]; obj != nil && obj.Pkg() != nil && obj.Pkg().Scope().Lookup(name) != nil {
+			return true
+		}
+		found := false
+		if fd.Body != nil {
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+					found = true
+				}
+				return !found
+			})
+		}
+		return found
+	}
+
+	reported := make(map[string]bool)
+	report := func(name, why string) {
+		if reported[name] || isKnown(name) {
+			return
+		}
+		reported[name] = true
+		issues = append(issues, fmt.Sprintf("doc mentions %s %s, which is not a parameter, result or known identifier", name, why))
+	}
+	for _, m := range docParamRef.FindAllStringSubmatch(doc, -1) {
+		name := m[1]
+		if name == "" {
+			name = m[2]
+		}
+		report(name, "as a parameter")
+	}
+	for _, m := range docBacktickRef.FindAllStringSubmatch(doc, -1) {
+		report(m[1], "in code quotes")
+	}
+	for _, m := range docCodeWord.FindAllStringSubmatch(doc, -1) {
+		report(m[1], "as an identifier")
+	}
+
+	// Results described in prose
+	hasError, hasBool := false, false
+	if obj := info.Defs[fd.Name]; obj != nil {
+		results := obj.Type().(*types.Signature).Results()
+		for i := 0; i < results.Len(); i++ {
+			t := results.At(i).Type()
+			if types.Identical(t, errorType) {
+				hasError = true
+			}
+			if basic, ok := t.Underlying().(*types.Basic); ok && basic.Kind() == types.Bool {
+				hasBool = true
+			}
+		}
+		if docReturnsError.MatchString(doc) && !hasError {
+			issues = append(issues, "doc describes an error result, but the function doesn't return an error")
+		}
+		if docReturnsBool.MatchString(doc) && !hasBool {
+			issues = append(issues, "doc describes a boolean result, but the function doesn't return a bool")
+		}
+	}
+
+	return issues
+}
+
+func registerDocConsistencyTool(a *Agent) {
+	a.tools["doc_consistency"] = Tool{
+		Name:        "doc_consistency",
+		Description: "Heuristically check whether Go doc comments still match their function signatures, flagging references to parameters or results that no longer exist",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file or package directory to check",
+				},
+				"function": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the function to check, e.g. 'parse' or 'Agent.Run'. If omitted every documented function is checked",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			function, _ := input["function"].(string)
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			fset, files, err := parseGoFiles(path)
+			if err != nil {
+				return "", err
+			}
+			info := typeCheck(fset, files)
+
+			var decls []*ast.FuncDecl
+			if function != "" {
+				decls = findFuncDecls(files, function)
+				if len(decls) == 0 {
+					return "", fmt.Errorf("function %s not found in %s", function, path)
+				}
+			} else {
+				for _, file := range files {
+					for _, decl := range file.Decls {
+						if fd, ok := decl.(*ast.FuncDecl); ok {
+							decls = append(decls, fd)
+						}
+					}
+				}
+			}
+
+			results := []DocIssue{}
+			for _, fd := range decls {
+				if issues := checkDocConsistency(fd, info); len(issues) > 0 {
+					results = append(results, DocIssue{
+						Function: funcDeclName(fd),
+						Location: positionString(fset, fd.Pos()),
+						Issues:   issues,
+					})
+				}
+			}
+
+			result, err := json.Marshal(results)
+			return string(result), err
+		},
+	}
+}
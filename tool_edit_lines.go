@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// splitLinesKeepEnds splits content into lines that keep their line breaks. A
+// trailing line break doesn't start another line.
+func splitLinesKeepEnds(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func registerEditLinesTool(a *Agent) {
+	a.tools["edit_lines"] = Tool{
+		Name:        "edit_lines",
+		Description: "Replace a range of lines in a file with new content. Use it when the line numbers are already known, for example from read_file or gopls, otherwise prefer search_replace. Empty content deletes the lines. Line numbers after the range shift by the difference in lines",
+		Writes:      true,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the file to edit",
+				},
+				"start_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "First line to replace, starting at 1",
+				},
+				"end_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "Last line to replace, inclusive",
+				},
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "The lines to put in place of the range",
+				},
+			},
+			"required": []string{"path", "start_line", "end_line", "content"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, _ := input["path"].(string)
+			start, _ := input["start_line"].(float64)
+			end, _ := input["end_line"].(float64)
+			replacement, _ := input["content"].(string)
+			startLine, endLine := int(start), int(end)
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("error reading file: %v", err)
+			}
+			// Work on \n line endings, writeWithConfirmation restores \r\n
+			if usesCRLF(content) {
+				content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+				replacement = strings.ReplaceAll(replacement, "\r\n", "\n")
+			}
+
+			lines := splitLinesKeepEnds(string(content))
+			if startLine < 1 || startLine > len(lines) {
+				return "", fmt.Errorf("start_line %d is outside the file, which has %d lines", startLine, len(lines))
+			}
+			if endLine < startLine || endLine > len(lines) {
+				return "", fmt.Errorf("end_line %d must be between start_line %d and the last line %d", endLine, startLine, len(lines))
+			}
+
+			// The replacement ends in a line break unless it replaces a last
+			// line that had none
+			lastHadNewline := strings.HasSuffix(lines[endLine-1], "\n")
+			if replacement != "" && lastHadNewline && !strings.HasSuffix(replacement, "\n") {
+				replacement += "\n"
+			}
+			if !lastHadNewline {
+				replacement = strings.TrimSuffix(replacement, "\n")
+			}
+
+			newContent := strings.Join(lines[:startLine-1], "") + replacement + strings.Join(lines[endLine:], "")
+			err = writeWithConfirmation(path, []byte(newContent), a.writeOptions())
+			if err != nil {
+				return "", err
+			}
+
+			newLines := strings.Count(replacement, "\n")
+			if replacement != "" && !strings.HasSuffix(replacement, "\n") {
+				newLines++
+			}
+			return fmt.Sprintf("Changes applied successfully, lines %d-%d replaced by %d lines", startLine, endLine, newLines), nil
+		},
+	}
+}
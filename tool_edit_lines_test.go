@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// assertCRLF fails unless every line of content ends in \r\n
+func assertCRLF(t *testing.T, content string) {
+	t.Helper()
+	lines := strings.SplitAfter(content, "\n")
+	for i, line := range lines[:len(lines)-1] {
+		if !strings.HasSuffix(line, "\r\n") {
+			t.Errorf("line %d %q doesn't end in \\r\\n", i+1, line)
+		}
+	}
+	if last := lines[len(lines)-1]; last != "" {
+		t.Errorf("last line %q has no line ending", last)
+	}
+}
+
+func TestCRLFRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	original := "package main\r\n\r\nfunc main() {\r\n\tprintln(\"a\")\r\n}\r\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Agent{tools: make(map[string]Tool), dir: dir, yolo: true, output: terminalOutput(io.Discard)}
+	registerSearchReplaceTool(a)
+	registerEditLinesTool(a)
+
+	// The model writes \n line endings in both the search and the replacement
+	if _, err := a.tools["search_replace"].Execute(map[string]interface{}{
+		"path":    path,
+		"search":  "func main() {\n\tprintln(\"a\")\n}",
+		"replace": "func main() {\n\tprintln(\"b\")\n\tprintln(\"c\")\n}",
+	}); err != nil {
+		t.Fatalf("search_replace: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package main\r\n\r\nfunc main() {\r\n\tprintln(\"b\")\r\n\tprintln(\"c\")\r\n}\r\n"; string(content) != want {
+		t.Errorf("after search_replace got %q, want %q", content, want)
+	}
+	assertCRLF(t, string(content))
+
+	if _, err := a.tools["edit_lines"].Execute(map[string]interface{}{
+		"path":       path,
+		"start_line": float64(4),
+		"end_line":   float64(5),
+		"content":    "\tprintln(\"d\")\n\tprintln(\"e\")\n\tprintln(\"f\")\n",
+	}); err != nil {
+		t.Fatalf("edit_lines: %v", err)
+	}
+	content, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "package main\r\n\r\nfunc main() {\r\n\tprintln(\"d\")\r\n\tprintln(\"e\")\r\n\tprintln(\"f\")\r\n}\r\n"; string(content) != want {
+		t.Errorf("after edit_lines got %q, want %q", content, want)
+	}
+	assertCRLF(t, string(content))
+}
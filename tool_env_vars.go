@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type EnvVarInfo struct {
+	Name      string   `json:"name"`
+	Locations []string `json:"locations"`
+}
+
+// envReaders maps import paths to the functions in them that read
+// environment variables
+var envReaders = map[string]map[string]bool{
+	"os":                     {"Getenv": true, "LookupEnv": true},
+	"syscall":                {"Getenv": true},
+	"github.com/spf13/viper": {"BindEnv": true},
+}
+
+// envVarNames returns the environment variable names read by call.
+// Names that aren't string literals are reported as <dynamic>.
+func envVarNames(pkgPath, funcName string, call *ast.CallExpr) []string {
+	var args []ast.Expr
+	if pkgPath == "github.com/spf13/viper" {
+		// viper.BindEnv("key") binds KEY, viper.BindEnv("key", "ENV_A", "ENV_B") binds the rest
+		if len(call.Args) > 1 {
+			args = call.Args[1:]
+		} else {
+			args = call.Args
+		}
+	} else if len(call.Args) > 0 {
+		args = call.Args[:1]
+	}
+
+	var names []string
+	for _, arg := range args {
+		lit, ok := arg.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			names = append(names, "<dynamic>")
+			continue
+		}
+		name, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			continue
+		}
+		if pkgPath == "github.com/spf13/viper" && len(call.Args) == 1 {
+			name = strings.ToUpper(name)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func registerEnvVarsTool(a *Agent) {
+	a.tools["env_vars"] = Tool{
+		Name:        "env_vars",
+		Description: "List the environment variables a Go program reads (os.Getenv, os.LookupEnv, viper.BindEnv) with the locations they are read from",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file or directory to scan. Directories are scanned recursively",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			fset, files, err := parseGoFiles(path)
+			if err != nil {
+				return "", err
+			}
+
+			found := make(map[string]*EnvVarInfo)
+			for _, file := range files {
+				for pkgPath, funcs := range envReaders {
+					localName := importedAs(file, pkgPath)
+					if localName == "" {
+						continue
+					}
+					ast.Inspect(file, func(n ast.Node) bool {
+						call, ok := n.(*ast.CallExpr)
+						if !ok {
+							return true
+						}
+						funcName, ok := isPkgCall(call, localName)
+						if !ok || !funcs[funcName] {
+							return true
+						}
+						for _, name := range envVarNames(pkgPath, funcName, call) {
+							info, ok := found[name]
+							if !ok {
+								info = &EnvVarInfo{Name: name}
+								found[name] = info
+							}
+							info.Locations = append(info.Locations, positionString(fset, call.Pos()))
+						}
+						return true
+					})
+				}
+			}
+
+			vars := []EnvVarInfo{}
+			for _, info := range found {
+				vars = append(vars, *info)
+			}
+			sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+
+			result, err := json.Marshal(vars)
+			return string(result), err
+		},
+	}
+}
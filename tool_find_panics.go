@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"os"
+	"strings"
+)
+
+type PanicSite struct {
+	Location string `json:"location"`
+	Call     string `json:"call"`
+	Function string `json:"function"`
+	Context  string `json:"context"`
+}
+
+// panicContext classifies where a crashing call lives. Crashing in main,
+// init or tests is usually acceptable, in library code it usually isn't.
+func panicContext(file *ast.File, filename string, fd *ast.FuncDecl) string {
+	switch {
+	case strings.HasSuffix(filename, "_test.go"):
+		return "test"
+	case file.Name.Name == "main":
+		return "main"
+	case fd != nil && fd.Recv == nil && fd.Name.Name == "init":
+		return "init"
+	case fd != nil && strings.HasPrefix(fd.Name.Name, "Must"):
+		return "must"
+	}
+	return "library"
+}
+
+func registerFindPanicsTool(a *Agent) {
+	a.tools["find_panics"] = Tool{
+		Name:        "find_panics",
+		Description: "Find calls that crash the program: panic(...), log.Fatal*, log.Panic* and os.Exit. Each site is classified as main, init, test, must (Must* helpers) or library, where library sites are usually the ones that should return errors instead",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file or directory to scan. Directories are scanned recursively",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			fset, files, err := parseGoFiles(path)
+			if err != nil {
+				return "", err
+			}
+
+			sites := []PanicSite{}
+			for _, file := range files {
+				filename := fset.Position(file.Pos()).Filename
+				logName := importedAs(file, "log")
+				osName := importedAs(file, "os")
+
+				for _, decl := range file.Decls {
+					fd, _ := decl.(*ast.FuncDecl)
+					function := ""
+					if fd != nil {
+						function = funcDeclName(fd)
+					}
+					ast.Inspect(decl, func(n ast.Node) bool {
+						call, ok := n.(*ast.CallExpr)
+						if !ok {
+							return true
+						}
+
+						name := ""
+						if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "panic" && ident.Obj == nil {
+							name = "panic"
+						} else if fn, ok := isPkgCall(call, logName); ok && (strings.HasPrefix(fn, "Fatal") || strings.HasPrefix(fn, "Panic")) {
+							name = logName + "." + fn
+						} else if fn, ok := isPkgCall(call, osName); ok && fn == "Exit" {
+							name = osName + "." + fn
+						}
+						if name == "" {
+							return true
+						}
+
+						sites = append(sites, PanicSite{
+							Location: positionString(fset, call.Pos()),
+							Call:     name,
+							Function: function,
+							Context:  panicContext(file, filename, fd),
+						})
+						return true
+					})
+				}
+			}
+
+			result, err := json.Marshal(sites)
+			return string(result), err
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func registerGitBlameTool(a *Agent) {
+	a.tools["git_blame"] = Tool{
+		Name:        "git_blame",
+		Description: "Show which commit last changed each line of a file, with hash, date, author and commit summary",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The file to blame",
+				},
+				"start_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "First line to blame, 1-based",
+				},
+				"end_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "Last line to blame, defaults to start_line",
+				},
+			},
+			"required": []string{"path", "start_line"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, _ := input["path"].(string)
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+			start, _ := input["start_line"].(float64)
+			end, ok := input["end_line"].(float64)
+			if !ok {
+				end = start
+			}
+			if start < 1 || end < start {
+				return "", fmt.Errorf("invalid line range %v-%v", start, end)
+			}
+
+			porcelain, err := runGit("blame", "--porcelain", fmt.Sprintf("-L%d,%d", int(start), int(end)), "--", path)
+			if err != nil {
+				return "", err
+			}
+			return formatBlame(porcelain), nil
+		},
+	}
+}
+
+// blameCommit is the part of a commit's porcelain headers shown per line
+type blameCommit struct {
+	author  string
+	date    string
+	summary string
+}
+
+// formatBlame turns git blame --porcelain output into one line per source
+// line. Porcelain only lists a commit's headers the first time it appears.
+func formatBlame(porcelain string) string {
+	commits := make(map[string]*blameCommit)
+	var current *blameCommit
+	var hash, lineNo string
+	var b strings.Builder
+
+	for _, line := range strings.Split(porcelain, "\n") {
+		// A line group header: <hash> <original line> <final line> [<count>]
+		if fields := strings.Fields(line); !strings.HasPrefix(line, "\t") && len(fields) >= 3 && isCommitHash(fields[0]) {
+			hash, lineNo = fields[0], fields[2]
+			if commits[hash] == nil {
+				commits[hash] = &blameCommit{}
+			}
+			current = commits[hash]
+			continue
+		}
+		if current == nil {
+			// Nothing to attribute the line to before the first header
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			fmt.Fprintf(&b, "%s %s %s %s (%s): %s\n", lineNo, hash[:8], current.date, current.author, current.summary, line[1:])
+		case strings.HasPrefix(line, "author "):
+			current.author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			if sec, err := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64); err == nil {
+				current.date = time.Unix(sec, 0).Format("2006-01-02")
+			}
+		case strings.HasPrefix(line, "summary "):
+			current.summary = strings.TrimPrefix(line, "summary ")
+		}
+	}
+	return b.String()
+}
+
+// isCommitHash reports whether s is a full SHA-1 or SHA-256 commit hash
+func isCommitHash(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatBlame(t *testing.T) {
+	sha1 := strings.Repeat("a1", 20)
+	sha256 := strings.Repeat("b2", 32)
+	porcelain := sha1 + " 1 1 1\n" +
+		"author Ann\n" +
+		"author-time 1700000000\n" +
+		"summary First\n" +
+		"filename main.go\n" +
+		"\tpackage main\n" +
+		sha256 + " 2 2 1\n" +
+		"author Bob\n" +
+		"author-time 1700000000\n" +
+		"summary Second\n" +
+		"filename main.go\n" +
+		"\tfunc main() {}\n" +
+		sha1 + " 2 3\n" +
+		"\t// a1a1 is not a header\n"
+	date := time.Unix(1700000000, 0).Format("2006-01-02")
+	want := "1 a1a1a1a1 " + date + " Ann (First): package main\n" +
+		"2 b2b2b2b2 " + date + " Bob (Second): func main() {}\n" +
+		"3 a1a1a1a1 " + date + " Ann (First): // a1a1 is not a header\n"
+	if got := formatBlame(porcelain); got != want {
+		t.Errorf("formatBlame() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatBlameUnknownHeader(t *testing.T) {
+	// Lines before a header it understands must not be attributed to a nil
+	// commit
+	porcelain := "abc123 1 1 1\nauthor Ann\n\tpackage main\n"
+	if got := formatBlame(porcelain); got != "" {
+		t.Errorf("formatBlame() = %q, want nothing", got)
+	}
+}
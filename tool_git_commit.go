@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func registerGitCommitTool(a *Agent) {
+	a.tools["git_commit"] = Tool{
+		Name:        "git_commit",
+		Description: "Stage changes and commit them to the git repository. Returns the hash of the new commit",
+		Writes:      true,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"message": map[string]interface{}{
+					"type":        "string",
+					"description": "The commit message",
+				},
+				"paths": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Files to stage before committing. Defaults to all changes to tracked files",
+				},
+			},
+			"required": []string{"message"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			message, _ := input["message"].(string)
+			if strings.TrimSpace(message) == "" {
+				return "", fmt.Errorf("commit message is empty")
+			}
+
+			// The given paths are staged, or everything tracked
+			add := []string{"add", "-u"}
+			if paths, ok := input["paths"].([]interface{}); ok && len(paths) > 0 {
+				add = []string{"add", "--"}
+				for _, p := range paths {
+					path, _ := p.(string)
+					if !a.isPathSafe(path) {
+						return "", os.ErrPermission
+					}
+					add = append(add, path)
+				}
+			}
+
+			// Preview the commit in a copy of the index, so nothing is
+			// staged until the user agrees
+			stat, err := previewStaged(add)
+			if err != nil {
+				return "", err
+			}
+			if stat == "" {
+				return "", fmt.Errorf("nothing staged to commit")
+			}
+			if !a.autoApply() {
+				fmt.Fprintf(os.Stderr, "\n%s\n%s", message, stat)
+				if !confirm("Commit these changes?") {
+					return "commit rejected by the user, nothing was staged", nil
+				}
+			}
+
+			if _, err := runGit(add...); err != nil {
+				return "", err
+			}
+			if _, err := runGit("commit", "-m", message); err != nil {
+				return "", err
+			}
+			hash, err := runGit("rev-parse", "HEAD")
+			if err != nil {
+				return "", err
+			}
+			return "committed " + strings.TrimSpace(hash), nil
+		},
+	}
+}
+
+// previewStaged runs the git add arguments against a copy of the index and
+// returns the stat of what would be committed, or "" if nothing would be
+func previewStaged(add []string) (string, error) {
+	indexPath, err := runGit("rev-parse", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "halu-index-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A repository without commits or staged files may have no index yet
+	tempIndex := filepath.Join(dir, "index")
+	content, err := os.ReadFile(strings.TrimSpace(indexPath))
+	if err == nil {
+		err = os.WriteFile(tempIndex, content, 0o644)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("error copying the git index: %v", err)
+	}
+
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"--no-pager"}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+tempIndex)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s failed: %v\n%s", args[0], err, output)
+		}
+		return string(output), nil
+	}
+	if _, err := run(add...); err != nil {
+		return "", err
+	}
+	return run("diff", "--cached", "--stat")
+}
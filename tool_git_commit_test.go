@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitCommitStagesOnlyOnceConfirmed(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	for _, env := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(env, "test")
+	}
+	for _, env := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(env, "test@example.com")
+	}
+
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q")
+	if err := os.WriteFile("a.txt", []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "a.txt")
+	git("commit", "-q", "-m", "initial")
+	if err := os.WriteFile("a.txt", []byte("b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a terminal to confirm on, the commit is rejected
+	a := &Agent{tools: make(map[string]Tool), dir: dir, output: terminalOutput(io.Discard)}
+	registerGitCommitTool(a)
+	for _, input := range []map[string]interface{}{
+		{"message": "change a"},
+		{"message": "change a", "paths": []interface{}{filepath.Join(dir, "a.txt")}},
+	} {
+		result, err := a.tools["git_commit"].Execute(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(result, "rejected") {
+			t.Errorf("git_commit() = %q, want it rejected", result)
+		}
+		if staged := git("diff", "--cached", "--name-only"); staged != "" {
+			t.Errorf("rejected commit staged %q", staged)
+		}
+	}
+	if log := git("log", "--oneline"); strings.Count(log, "\n") != 1 {
+		t.Errorf("rejected commit was made:\n%s", log)
+	}
+
+	a.yolo = true
+	result, err := a.tools["git_commit"].Execute(map[string]interface{}{"message": "change a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(result, "committed ") {
+		t.Errorf("git_commit() = %q, want a commit", result)
+	}
+	if status := git("status", "--porcelain"); status != "" {
+		t.Errorf("changes left after the commit: %q", status)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+)
+
+func registerGitDiffTool(a *Agent) {
+	a.tools["git_diff"] = Tool{
+		Name:        "git_diff",
+		Description: "Show the uncommitted changes in the git repository as a patch, e.g. to review or summarize the edits made so far",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"staged": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Show the staged changes instead of the unstaged ones",
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Only show changes to this file or directory",
+				},
+			},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			args := []string{"diff"}
+			if staged, _ := input["staged"].(bool); staged {
+				args = append(args, "--staged")
+			}
+			if path, _ := input["path"].(string); path != "" {
+				if !a.isPathSafe(path) {
+					return "", os.ErrPermission
+				}
+				args = append(args, "--", path)
+			}
+
+			diff, err := runGit(args...)
+			if err != nil {
+				return "", err
+			}
+			if diff == "" {
+				return "No changes.", nil
+			}
+			return diff, nil
+		},
+	}
+}
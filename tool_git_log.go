@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func registerGitLogTool(a *Agent) {
+	a.tools["git_log"] = Tool{
+		Name:        "git_log",
+		Description: "Show the commit history of a file or directory with hash, date, author and summary, to understand why code is the way it is",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The file or directory to show the history of",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum number of commits to show, defaults to 20",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, _ := input["path"].(string)
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+			limit := 20
+			if l, ok := input["limit"].(float64); ok && l > 0 {
+				limit = int(l)
+			}
+
+			log, err := runGit("log", fmt.Sprintf("-n%d", limit), "--date=short", "--format=%h %ad %an: %s", "--", path)
+			if err != nil {
+				return "", err
+			}
+			if log == "" {
+				return "No commits found for " + path, nil
+			}
+			return log, nil
+		},
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func registerGoAPITool(a *Agent) {
+	a.tools["go_api"] = Tool{
+		Name:        "go_api",
+		Description: "List the exported API of a Go package: constants, variables, functions, and types with their exported fields and methods, one signature per line and without docs. Cheaper than reading the source or go_doc to get the public surface of a package",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"package": map[string]interface{}{
+					"type":        "string",
+					"description": "The package directory like ./pkg/foo, or an import path like net/http (default: .)",
+				},
+			},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			pkg, _ := input["package"].(string)
+			if pkg == "" {
+				pkg = "."
+			}
+			// go list would take it as a flag
+			if strings.HasPrefix(pkg, "-") {
+				return "", fmt.Errorf("package %q is a flag, expected a package like ./pkg/foo or net/http", pkg)
+			}
+
+			// Local directories are checked, import paths are resolved by go
+			// list and are read only for their declarations, like go_doc does
+			dir := pkg
+			if info, err := os.Stat(pkg); err == nil && info.IsDir() {
+				if !a.isPathSafe(pkg) {
+					return "", os.ErrPermission
+				}
+			} else {
+				output, err := exec.Command("go", "list", "-f", "{{.Dir}}", pkg).CombinedOutput()
+				if err != nil {
+					return string(output) + "\nError: " + err.Error(), nil
+				}
+				dir = strings.TrimSpace(string(output))
+			}
+
+			return exportedAPI(dir)
+		},
+	}
+}
+
+// exportedAPI summarizes the exported declarations of the package in dir.
+// Methods are listed below their type, methods of unexported types are
+// left out.
+func exportedAPI(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("error reading package directory: %v", err)
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		// Only the files built for this platform, so nothing is listed twice
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no Go files in %s", dir)
+	}
+
+	source := func(node ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, node)
+		return buf.String()
+	}
+
+	var consts, vars, funcs []string
+	var types []*ast.TypeSpec
+	methods := make(map[string][]string)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if !d.Name.IsExported() {
+					continue
+				}
+				signature := source(&ast.FuncDecl{Recv: d.Recv, Name: d.Name, Type: d.Type})
+				if d.Recv == nil {
+					funcs = append(funcs, signature)
+					continue
+				}
+				recv, _, _ := strings.Cut(funcDeclName(d), ".")
+				methods[recv] = append(methods[recv], signature)
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.ValueSpec:
+						line := valueSpecAPI(s, source)
+						if line == "" {
+							continue
+						}
+						if d.Tok == token.CONST {
+							consts = append(consts, "const "+line)
+						} else {
+							vars = append(vars, "var "+line)
+						}
+					case *ast.TypeSpec:
+						if s.Name.IsExported() {
+							types = append(types, s)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n", files[0].Name.Name)
+	for _, group := range [][]string{consts, vars, funcs} {
+		if len(group) == 0 {
+			continue
+		}
+		b.WriteString("\n")
+		for _, line := range group {
+			b.WriteString(line + "\n")
+		}
+	}
+	for _, spec := range types {
+		b.WriteString("\n" + typeSpecAPI(spec, source))
+		for _, method := range methods[spec.Name.Name] {
+			b.WriteString("    " + method + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// valueSpecAPI formats the exported names of a const or var spec with their
+// type, or returns "" if none is exported
+func valueSpecAPI(s *ast.ValueSpec, source func(ast.Node) string) string {
+	var names []string
+	for _, name := range s.Names {
+		if name.IsExported() {
+			names = append(names, name.Name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	line := strings.Join(names, ", ")
+	if s.Type != nil {
+		line += " " + source(s.Type)
+	}
+	return line
+}
+
+// typeSpecAPI formats a type declaration. Structs and interfaces list only
+// their exported fields and methods, one per line.
+func typeSpecAPI(s *ast.TypeSpec, source func(ast.Node) string) string {
+	header := "type " + s.Name.Name
+	if s.TypeParams != nil {
+		var params []string
+		for _, field := range s.TypeParams.List {
+			var names []string
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			params = append(params, strings.Join(names, ", ")+" "+source(field.Type))
+		}
+		header += "[" + strings.Join(params, ", ") + "]"
+	}
+
+	var members *ast.FieldList
+	isInterface := false
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		header += " struct"
+		members = t.Fields
+	case *ast.InterfaceType:
+		header += " interface"
+		members = t.Methods
+		isInterface = true
+	default:
+		if s.Assign.IsValid() {
+			header += " ="
+		}
+		return header + " " + source(s.Type) + "\n"
+	}
+
+	var b strings.Builder
+	b.WriteString(header + "\n")
+	for _, field := range members.List {
+		typ := source(field.Type)
+		if len(field.Names) == 0 {
+			// Embedded interfaces and constraints always matter, embedded
+			// struct fields only when exported
+			if isInterface || embeddedExported(field.Type) {
+				b.WriteString("    " + typ + "\n")
+			}
+			continue
+		}
+		if isInterface {
+			// Methods read like Name(args) results
+			typ = strings.TrimPrefix(typ, "func")
+		} else {
+			typ = " " + typ
+		}
+		for _, name := range field.Names {
+			if name.IsExported() {
+				b.WriteString("    " + name.Name + typ + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// embeddedExported reports whether an embedded struct field, like *pkg.Type
+// or Type[T], is exported
+func embeddedExported(expr ast.Expr) bool {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			return e.Sel.IsExported()
+		case *ast.Ident:
+			return e.IsExported()
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// maxCoverOutput bounds the coverage report returned to the model
+const maxCoverOutput = 30000
+
+func registerGoCoverTool(a *Agent) {
+	a.tools["go_cover"] = Tool{
+		Name:        "go_cover",
+		Description: "Run the tests of a Go package with coverage and report the coverage of every function and the total, to find untested code",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The package to test, like ./pkg/foo or ./... for the entire project",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			// go test would take it as a flag like -toolexec, which runs commands
+			if strings.HasPrefix(path, "-") {
+				return "", fmt.Errorf("path %q is a flag, expected a package like ./pkg/foo", path)
+			}
+			if !a.isPackagePathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			profile, err := os.CreateTemp("", "halu-cover-*")
+			if err != nil {
+				return "", fmt.Errorf("error creating coverage profile: %v", err)
+			}
+			profile.Close()
+			defer os.Remove(profile.Name())
+
+			// Failing tests still produce a profile, so the test output is
+			// only returned when there is nothing to report
+			output, err := exec.Command("go", "test", "-coverprofile", profile.Name(), path).CombinedOutput()
+			if info, statErr := os.Stat(profile.Name()); err != nil && (statErr != nil || info.Size() == 0) {
+				return string(output) + "\nError: " + err.Error(), nil
+			}
+
+			report, err := exec.Command("go", "tool", "cover", "-func", profile.Name()).CombinedOutput()
+			if err != nil {
+				return string(report) + "\nError: " + err.Error(), nil
+			}
+
+			result := string(report)
+			if len(result) > maxCoverOutput {
+				// Keep the end, the total is on the last line
+				result = "... [output truncated]\n" + result[len(result)-maxCoverOutput:]
+			}
+			return result, nil
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Definition is where a symbol is defined
+type Definition struct {
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Source    string `json:"source,omitempty"`
+}
+
+func registerGoDefinitionTool(a *Agent) {
+	a.tools["go_definition"] = Tool{
+		Name:        "go_definition",
+		Description: "Find where the Go symbol at a position is defined, using gopls. Returns the defining file and the line range of its declaration",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file the symbol is used in",
+				},
+				"line": map[string]interface{}{
+					"type":        "integer",
+					"description": "The line of the symbol, 1-based",
+				},
+				"column": map[string]interface{}{
+					"type":        "integer",
+					"description": "The column of the symbol, 1-based",
+				},
+				"include_source": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Also return the source text of the declaration",
+				},
+			},
+			"required": []string{"path", "line", "column"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+			line, _ := input["line"].(float64)
+			column, _ := input["column"].(float64)
+			if line < 1 || column < 1 {
+				return "", fmt.Errorf("line and column are 1-based")
+			}
+			includeSource, _ := input["include_source"].(bool)
+
+			s, err := a.goplsSession()
+			if err != nil {
+				return "", err
+			}
+			definitions, err := s.findDefinition(path, int(line)-1, int(column)-1)
+			if err != nil {
+				return "", err
+			}
+
+			// Only show source the model could read anyway
+			for i := range definitions {
+				if !includeSource || !a.isPathSafe(definitions[i].File) {
+					definitions[i].Source = ""
+				}
+			}
+
+			result, err := json.MarshalIndent(definitions, "", "  ")
+			if err != nil {
+				return "", fmt.Errorf("error marshaling result: %v", err)
+			}
+			return string(result), nil
+		},
+	}
+}
+
+// findDefinition asks gopls for the definition of the symbol at the 0-based
+// position, and widens each location to the whole declaration it names
+func (s *goplsSession) findDefinition(filePath string, line, character int) ([]Definition, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	_, uri, _, err := s.sync(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []Location
+	err = s.conn.Call(context.Background(), "textDocument/definition", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	}, &locations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get definition: %v", err)
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("no definition found at %s:%d:%d", filePath, line+1, character+1)
+	}
+
+	var definitions []Definition
+	for _, location := range locations {
+		start, end := location.Range.Start.Line, location.Range.End.Line
+
+		if symbols, err := s.documentSymbols(location.URI); err == nil {
+			if symbol := declaredSymbol(symbols, location.Range.Start); symbol != nil {
+				start, end = symbol.Range.Start.Line, symbol.Range.End.Line
+			}
+		}
+
+		definition := Definition{
+			File:      uriPath(location.URI),
+			StartLine: start + 1,
+			EndLine:   end + 1,
+		}
+		if content, err := os.ReadFile(definition.File); err == nil {
+			lines := strings.Split(string(content), "\n")
+			if end < len(lines) {
+				definition.Source = strings.Join(lines[start:end+1], "\n")
+			}
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// diagnosticsTimeout bounds how long to wait for gopls to check a file
+const diagnosticsTimeout = 15 * time.Second
+
+// diagnosticsSettle is how long to wait for updates after the first
+// diagnostics arrive, gopls may publish type errors and analyzer findings
+// separately
+const diagnosticsSettle = 500 * time.Millisecond
+
+// diagnosticSeverities names the LSP severities
+var diagnosticSeverities = map[int]string{1: "error", 2: "warning", 3: "info", 4: "hint"}
+
+func registerGoDiagnosticsTool(a *Agent) {
+	a.tools["go_diagnostics"] = Tool{
+		Name:        "go_diagnostics",
+		Description: "Check a single Go file with gopls and list its compile errors and warnings with positions. Faster than building the whole project",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file to check",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			s, err := a.goplsSession()
+			if err != nil {
+				return "", err
+			}
+			diagnostics, err := s.fileDiagnostics(path)
+			if err != nil {
+				return "", err
+			}
+			if len(diagnostics) == 0 {
+				return "No issues found by gopls.", nil
+			}
+
+			var b strings.Builder
+			for _, d := range diagnostics {
+				severity := diagnosticSeverities[d.Severity]
+				if severity == "" {
+					severity = "error"
+				}
+				fmt.Fprintf(&b, "%s:%d:%d: %s: %s", path, d.Range.Start.Line+1, d.Range.Start.Character+1, severity, d.Message)
+				if d.Source != "" {
+					fmt.Fprintf(&b, " (%s)", d.Source)
+				}
+				b.WriteString("\n")
+			}
+			return b.String(), nil
+		},
+	}
+}
+
+// fileDiagnostics syncs the file with gopls and waits for the diagnostics it
+// publishes for it. Unchanged files aren't checked again.
+func (s *goplsSession) fileDiagnostics(filePath string) ([]Diagnostic, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	// Watch before syncing so the diagnostics can't be missed
+	published, stop := s.watchDiagnostics("file://" + absPath)
+	defer stop()
+
+	_, uri, changed, err := s.sync(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		if diagnostics, ok := s.lastDiagnostics(uri); ok {
+			return diagnostics, nil
+		}
+	}
+
+	var diagnostics []Diagnostic
+	select {
+	case diagnostics = <-published:
+	case <-time.After(diagnosticsTimeout):
+		return nil, fmt.Errorf("gopls published no diagnostics for %s within %s", filePath, diagnosticsTimeout)
+	}
+
+	// Later publications replace earlier ones
+	for {
+		select {
+		case diagnostics = <-published:
+		case <-time.After(diagnosticsSettle):
+			return diagnostics, nil
+		}
+	}
+}
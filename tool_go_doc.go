@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
 )
 
@@ -19,7 +20,10 @@ func registerGoDocTool(a *Agent) {
 			"required": []string{"query"},
 		},
 		Execute: func(input map[string]interface{}) (string, error) {
-			query := input["query"].(string)
+			query, ok := input["query"].(string)
+			if !ok {
+				return "", fmt.Errorf("query is required")
+			}
 
 			// Execute the go doc command
 			cmd := exec.Command("go", "doc", query)
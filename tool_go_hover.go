@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func registerGoHoverTool(a *Agent) {
+	a.tools["go_hover"] = Tool{
+		Name:        "go_hover",
+		Description: "Show the signature and doc comment of the Go symbol at a position, using gopls. Works for local and unexported identifiers too",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file the symbol is used in",
+				},
+				"line": map[string]interface{}{
+					"type":        "integer",
+					"description": "The line of the symbol, 1-based",
+				},
+				"column": map[string]interface{}{
+					"type":        "integer",
+					"description": "The column of the symbol, 1-based",
+				},
+			},
+			"required": []string{"path", "line", "column"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+			line, _ := input["line"].(float64)
+			column, _ := input["column"].(float64)
+			if line < 1 || column < 1 {
+				return "", fmt.Errorf("line and column are 1-based")
+			}
+
+			s, err := a.goplsSession()
+			if err != nil {
+				return "", err
+			}
+			return s.hover(path, int(line)-1, int(column)-1)
+		},
+	}
+}
+
+// hover returns gopls' description of the symbol at the 0-based position
+func (s *goplsSession) hover(filePath string, line, character int) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	_, uri, _, err := s.sync(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	var result *struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	err = s.conn.Call(context.Background(), "textDocument/hover", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	}, &result)
+	if err != nil {
+		return "", fmt.Errorf("failed to get hover: %v", err)
+	}
+	if result == nil || strings.TrimSpace(result.Contents.Value) == "" {
+		return "", fmt.Errorf("no symbol found at %s:%d:%d", filePath, line+1, character+1)
+	}
+	return result.Contents.Value, nil
+}
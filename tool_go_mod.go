@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func registerGoModTool(a *Agent) {
+	a.tools["go_mod"] = Tool{
+		Name:        "go_mod",
+		Description: "Manage the dependencies of the Go module: tidy go.mod, add or upgrade a dependency with go get, or explain why a package is needed with go mod why",
+		Writes:      true,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"subcommand": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{"tidy", "get", "why"},
+					"description": "tidy runs go mod tidy, get runs go get <package>, why runs go mod why <package>",
+				},
+				"package": map[string]interface{}{
+					"type":        "string",
+					"description": "The package for get and why, e.g. golang.org/x/sync@latest",
+				},
+			},
+			"required": []string{"subcommand"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			subcommand, _ := input["subcommand"].(string)
+			pkg, _ := input["package"].(string)
+
+			var args []string
+			switch subcommand {
+			case "tidy":
+				args = []string{"mod", "tidy"}
+			case "get", "why":
+				if pkg == "" || strings.HasPrefix(pkg, "-") {
+					return "", fmt.Errorf("%s needs a package", subcommand)
+				}
+				args = []string{"get", pkg}
+				if subcommand == "why" {
+					args = []string{"mod", "why", pkg}
+				}
+			default:
+				return "", fmt.Errorf("unknown subcommand %q, expected tidy, get or why", subcommand)
+			}
+
+			// Run in the module root, wherever in the module the cwd is
+			out, err := exec.Command("go", "env", "GOMOD").Output()
+			gomod := strings.TrimSpace(string(out))
+			if err != nil || gomod == "" || gomod == os.DevNull {
+				return "", fmt.Errorf("not inside a Go module")
+			}
+			root := filepath.Dir(gomod)
+
+			// tidy and get change go.mod and go.sum
+			if subcommand != "why" && !a.autoApply() {
+				if !confirm(fmt.Sprintf("Run go %s?", strings.Join(args, " "))) {
+					return fmt.Sprintf("go %s rejected by the user", strings.Join(args, " ")), nil
+				}
+			}
+
+			cmd := exec.Command("go", args...)
+			cmd.Dir = root
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				return string(output) + "\nError: " + err.Error(), nil
+			}
+			if len(output) == 0 {
+				return fmt.Sprintf("go %s succeeded.", strings.Join(args, " ")), nil
+			}
+			return string(output), nil
+		},
+	}
+}
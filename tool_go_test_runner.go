@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxTestOutput bounds the test output returned to the model
+const maxTestOutput = 30000
+
+func registerGoTestTool(a *Agent) {
+	a.tools["go_test"] = Tool{
+		Name:        "go_test",
+		Description: "Run the tests of a Go package, or just one test function with func, and report the output and how long the run took. Running a single test is much faster than the whole suite while iterating on a failure",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"package": map[string]interface{}{
+					"type":        "string",
+					"description": "The package to test, like ./pkg/foo or ./... for the entire project (default: .)",
+				},
+				"func": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the only test to run, like TestParse, or TestParse/empty for a subtest",
+				},
+			},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			pkg, _ := input["package"].(string)
+			if pkg == "" {
+				pkg = "."
+			}
+			// go test would take it as a flag like -toolexec, which runs commands
+			if strings.HasPrefix(pkg, "-") {
+				return "", fmt.Errorf("package %q is a flag, expected a package like ./pkg/foo", pkg)
+			}
+			if !a.isPackagePathSafe(pkg) {
+				return "", os.ErrPermission
+			}
+
+			// A single test always runs rather than coming from the cache
+			args := []string{"test"}
+			if name, _ := input["func"].(string); name != "" {
+				var parts []string
+				for _, part := range strings.Split(name, "/") {
+					parts = append(parts, "^"+regexp.QuoteMeta(part)+"$")
+				}
+				args = append(args, "-count=1", "-v", "-run", strings.Join(parts, "/"))
+			}
+			args = append(args, pkg)
+
+			start := time.Now()
+			output, err := exec.Command("go", args...).CombinedOutput()
+			elapsed := time.Since(start).Round(time.Millisecond)
+
+			result := string(output)
+			if len(result) > maxTestOutput {
+				// Keep the end, the failures and the summary are last
+				result = "... [output truncated]\n" + result[len(result)-maxTestOutput:]
+			}
+			if strings.Contains(result, "testing: warning: no tests to run") {
+				result += "\nNo test matched, check the name of func"
+			}
+			if err != nil {
+				result += "\nError: " + err.Error()
+			}
+			return fmt.Sprintf("%s\nTook %s", result, elapsed), nil
+		},
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoTestRejectsFlags(t *testing.T) {
+	// The package is checked against the working directory, so only the
+	// flag check stands between it and go test
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(t.TempDir(), "ran")
+	a := &Agent{tools: make(map[string]Tool), dir: wd}
+	registerGoTestTool(a)
+
+	for _, pkg := range []string{"-toolexec=touch " + marker, "--toolexec=touch " + marker, "-exec=touch " + marker} {
+		if _, err := a.tools["go_test"].Execute(map[string]interface{}{"package": pkg}); err == nil {
+			t.Errorf("go_test accepted package %q", pkg)
+		}
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("a command passed as a flag ran")
+	}
+}
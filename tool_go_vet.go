@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
 )
 
@@ -19,7 +20,10 @@ func registerGoVetTool(a *Agent) {
 			"required": []string{"path"},
 		},
 		Execute: func(input map[string]interface{}) (string, error) {
-			path := input["path"].(string)
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
 
 			// Execute the go vet command
 			cmd := exec.Command("go", "vet", path)
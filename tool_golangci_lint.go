@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func registerGolangciLintTool(a *Agent) {
+	a.tools["golangci_lint"] = Tool{
+		Name:        "golangci_lint",
+		Description: "Run the linters configured for the project using golangci-lint",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The package to lint, like ./pkg/foo or ./... for the entire project",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			// golangci-lint would take it as a flag like -c or --fix
+			if strings.HasPrefix(path, "-") {
+				return "", fmt.Errorf("path %q is a flag, expected a package like ./pkg/foo", path)
+			}
+			if !a.isPackagePathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			if _, err := exec.LookPath("golangci-lint"); err != nil {
+				return "golangci-lint is not installed, see https://golangci-lint.run/welcome/install/ or use go_vet instead.", nil
+			}
+
+			cmd := exec.Command("golangci-lint", "run", path)
+			output, err := cmd.CombinedOutput()
+
+			// Like go vet, golangci-lint exits with status 1 when it finds
+			// issues, which are the result we want
+			if err != nil {
+				var exitErr *exec.ExitError
+				if len(output) == 0 || !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+					return string(output) + "\nError running golangci-lint: " + err.Error(), nil
+				}
+				return string(output), nil
+			}
+
+			if len(output) == 0 {
+				return "No issues found by golangci-lint.", nil
+			}
+
+			return string(output), nil
+		},
+	}
+}
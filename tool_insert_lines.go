@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func registerInsertLinesTool(a *Agent) {
+	a.tools["insert_lines"] = Tool{
+		Name:        "insert_lines",
+		Description: "Insert content before a line of a file, or after it with after set, without changing the existing lines. Use it to add a function, method or import when the line is known, rather than search_replace",
+		Writes:      true,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the file to edit",
+				},
+				"line": map[string]interface{}{
+					"type":        "integer",
+					"description": "The line to insert at, starting at 1",
+				},
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "The lines to insert",
+				},
+				"after": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Insert after the line instead of before it (default: false)",
+				},
+			},
+			"required": []string{"path", "line", "content"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, _ := input["path"].(string)
+			line, _ := input["line"].(float64)
+			insert, _ := input["content"].(string)
+			after, _ := input["after"].(bool)
+			lineNumber := int(line)
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+			if insert == "" {
+				return "", fmt.Errorf("content is required")
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("error reading file: %v", err)
+			}
+			// Work on \n line endings, writeWithConfirmation restores \r\n
+			if usesCRLF(content) {
+				content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+				insert = strings.ReplaceAll(insert, "\r\n", "\n")
+			}
+
+			lines := splitLinesKeepEnds(string(content))
+			// An empty file only has a line 1 to insert at
+			if lineNumber < 1 || lineNumber > max(len(lines), 1) {
+				return "", fmt.Errorf("line %d is outside the file, which has %d lines", lineNumber, len(lines))
+			}
+
+			at := lineNumber - 1
+			if after && len(lines) > 0 {
+				at = lineNumber
+			}
+			if !strings.HasSuffix(insert, "\n") {
+				insert += "\n"
+			}
+			// Appending after a last line without a line break gives it one
+			if at == len(lines) && at > 0 && !strings.HasSuffix(lines[at-1], "\n") {
+				lines[at-1] += "\n"
+			}
+
+			newContent := strings.Join(lines[:at], "") + insert + strings.Join(lines[at:], "")
+			err = writeWithConfirmation(path, []byte(newContent), a.writeOptions())
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("Changes applied successfully, %d lines inserted at line %d", strings.Count(insert, "\n"), at+1), nil
+		},
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-	"bufio"
 )
 
 type FileInfo struct {
@@ -15,10 +16,11 @@ type FileInfo struct {
 	ModTime   string `json:"mod_time"`
 }
 
-// gitignoreMatch checks if a path matches a gitignore pattern
-func gitignoreMatch(pattern, path, basePath string) bool {
+// gitignoreMatch checks if a path matches a gitignore pattern. It also reports
+// whether the pattern is a negation, in which case a match un-ignores the path.
+func gitignoreMatch(pattern, path, basePath string) (matched bool, negated bool) {
 	if pattern == "" {
-		return false
+		return false, false
 	}
 	
 	// Remove leading and trailing whitespace
@@ -26,12 +28,12 @@ func gitignoreMatch(pattern, path, basePath string) bool {
 	
 	// Skip comment lines
 	if strings.HasPrefix(pattern, "#") {
-		return false
+		return false, false
 	}
 	
 	// Handle negation
-	isNegation := strings.HasPrefix(pattern, "!")
-	if isNegation {
+	negated = strings.HasPrefix(pattern, "!")
+	if negated {
 		pattern = pattern[1:]
 	}
 
@@ -47,14 +49,14 @@ func gitignoreMatch(pattern, path, basePath string) bool {
 	// Get relative path from the .gitignore location
 	relPath, err := filepath.Rel(basePath, path)
 	if err != nil {
-		return false
+		return false, negated
 	}
 
 	// Handle directory-only patterns
 	if strings.HasSuffix(pattern, "/") {
 		info, err := os.Stat(path)
 		if err != nil || !info.IsDir() {
-			return false
+			return false, negated
 		}
 		pattern = strings.TrimSuffix(pattern, "/")
 	}
@@ -68,7 +70,7 @@ func gitignoreMatch(pattern, path, basePath string) bool {
 	convertedPattern = strings.Replace(convertedPattern, "?", "[^/]", -1)
 	
 	// Match against both full path and relative path
-	matched, err := filepath.Match(convertedPattern, relPath)
+	matched, err = filepath.Match(convertedPattern, relPath)
 	if err != nil {
 		matched = false
 	}
@@ -79,52 +81,113 @@ func gitignoreMatch(pattern, path, basePath string) bool {
 		}
 	}
 
-	if isNegation {
-		return !matched
-	}
-	return matched
+	return matched, negated
 }
 
-// readGitignore reads .gitignore file and returns patterns
+// haluignoreFile hides files from the agent without changing what git
+// tracks. It uses the .gitignore syntax.
+const haluignoreFile = ".haluignore"
+
+// readGitignore reads the .gitignore and .haluignore files of dir and returns
+// their patterns. The .haluignore patterns come last, so they win.
 func readGitignore(dir string) []string {
-	ignoreFile := filepath.Join(dir, ".gitignore")
 	patterns := []string{}
-	
-	file, err := os.Open(ignoreFile)
-	if err != nil {
-		return patterns
-	}
-	defer file.Close()
-	
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		pattern := strings.TrimSpace(scanner.Text())
-		if pattern != "" && !strings.HasPrefix(pattern, "#") {
-			patterns = append(patterns, pattern)
+	for _, name := range []string{".gitignore", haluignoreFile} {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			pattern := strings.TrimSpace(scanner.Text())
+			if pattern != "" && !strings.HasPrefix(pattern, "#") {
+				patterns = append(patterns, pattern)
+			}
 		}
+		file.Close()
 	}
 	
 	return patterns
 }
 
-// shouldIgnore checks if a file should be ignored based on .gitignore patterns
+// shouldIgnore checks if a file should be ignored based on .gitignore and
+// .haluignore patterns. As in git, the last matching pattern wins: patterns
+// in a closer directory override those further up, and later lines override
+// earlier ones.
 func shouldIgnore(path string, ignorePatterns map[string][]string) bool {
-	// Check patterns from current directory up to root
-	dir := filepath.Dir(path)
-	for checkDir := dir; ; checkDir = filepath.Dir(checkDir) {
-		if patterns, exists := ignorePatterns[checkDir]; exists {
-			for _, pattern := range patterns {
-				if gitignoreMatch(pattern, path, checkDir) {
-					return true
-				}
-			}
-		}
+	// Collect directories from the file's directory up to root
+	var dirs []string
+	for checkDir := filepath.Dir(path); ; checkDir = filepath.Dir(checkDir) {
+		dirs = append(dirs, checkDir)
 		// Stop when we reach the root
 		if checkDir == "." || checkDir == "/" || filepath.Dir(checkDir) == checkDir {
 			break
 		}
 	}
-	return false
+
+	// Apply patterns from root down to the closest directory
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		for _, pattern := range ignorePatterns[dirs[i]] {
+			if matched, negated := gitignoreMatch(pattern, path, dirs[i]); matched {
+				ignored = !negated
+			}
+		}
+	}
+	return ignored
+}
+
+// walkIgnoring walks the tree rooted at path like filepath.Walk, but skips
+// dotfiles below path, anything matched by a .gitignore or .haluignore, and
+// paths that aren't safe to expose
+func (a *Agent) walkIgnoring(path string, fn func(currentPath string, info os.FileInfo) error) error {
+	// Store ignore patterns for each directory
+	ignorePatterns := make(map[string][]string)
+	
+	// First pass: collect all .gitignore patterns
+	filepath.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && a.isPathSafe(currentPath) {
+			patterns := readGitignore(currentPath)
+			if len(patterns) > 0 {
+				ignorePatterns[currentPath] = patterns
+			}
+		}
+		return nil
+	})
+
+	return filepath.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip dotfiles under the provided path, but allow the provided path itself to start with dot
+		if strings.HasPrefix(filepath.Base(currentPath), ".") && currentPath != path {
+			relPath, err := filepath.Rel(path, currentPath)
+			if err == nil && !strings.HasPrefix(relPath, "..") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		// Check if path should be ignored
+		if shouldIgnore(currentPath, ignorePatterns) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !a.isPathSafe(currentPath) {
+			return nil
+		}
+		return fn(currentPath, info)
+	})
 }
 
 func registerListFilesTool(a *Agent) {
@@ -138,66 +201,49 @@ func registerListFilesTool(a *Agent) {
 					"type":        "string",
 					"description": "The directory path to list files from",
 				},
+				"skip_binary": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Skip files that look binary (default: false)",
+				},
+				"max_file_size": map[string]interface{}{
+					"type":        "integer",
+					"description": "Skip files larger than this many bytes (default: no limit)",
+				},
 			},
 		},
 		Execute: func(input map[string]interface{}) (string, error) {
-			path := input["path"].(string)
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			skipBinary, _ := input["skip_binary"].(bool)
+			maxFileSize := int64(-1)
+			if size, ok := input["max_file_size"].(float64); ok && size >= 0 {
+				maxFileSize = int64(size)
+			}
 
-			if !isPathSafe(path) {
+			if !a.isPathSafe(path) {
 				return "", os.ErrPermission
 			}
 
-			// Store ignore patterns for each directory
-			ignorePatterns := make(map[string][]string)
-			
-			// First pass: collect all .gitignore patterns
-			filepath.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				if info.IsDir() && isPathSafe(currentPath) {
-					patterns := readGitignore(currentPath)
-					if len(patterns) > 0 {
-						ignorePatterns[currentPath] = patterns
-					}
-				}
-				return nil
-			})
-
 			var filesInfo []FileInfo
-			err := filepath.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-
-				// Skip dotfiles under the provided path, but allow the provided path itself to start with dot
-				if strings.HasPrefix(filepath.Base(currentPath), ".") && currentPath != path {
-					relPath, err := filepath.Rel(path, currentPath)
-					if err == nil && !strings.HasPrefix(relPath, "..") {
-						if info.IsDir() {
-							return filepath.SkipDir
-						}
+			err := a.walkIgnoring(path, func(currentPath string, info os.FileInfo) error {
+				// Skip artifacts the model can't use
+				if !info.IsDir() {
+					if maxFileSize >= 0 && info.Size() > maxFileSize {
 						return nil
 					}
-				}
-
-				// Check if path should be ignored
-				if shouldIgnore(currentPath, ignorePatterns) {
-					if info.IsDir() {
-						return filepath.SkipDir
+					if skipBinary && isBinaryFile(currentPath) {
+						return nil
 					}
-					return nil
 				}
 
-				if isPathSafe(currentPath) {
-					fileInfo := FileInfo{
-						Path:      currentPath,
-						IsDir:     info.IsDir(),
-						Size:      info.Size(),
-						ModTime:   info.ModTime().String(),
-					}
-					filesInfo = append(filesInfo, fileInfo)
-				}
+				filesInfo = append(filesInfo, FileInfo{
+					Path:      currentPath,
+					IsDir:     info.IsDir(),
+					Size:      info.Size(),
+					ModTime:   info.ModTime().String(),
+				})
 				return nil
 			})
 			
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShouldIgnoreNestedNegation(t *testing.T) {
+	patterns := map[string][]string{
+		"root":     {"*.log"},
+		"root/sub": {"!keep.log"},
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"root/app.log", true},
+		{"root/sub/other.log", true},
+		{"root/sub/keep.log", false},
+		{"root/keep.log", true},
+		{"root/sub/main.go", false},
+	}
+	for _, tt := range tests {
+		if got := shouldIgnore(tt.path, patterns); got != tt.want {
+			t.Errorf("shouldIgnore(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestListFilesNestedNegation(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":     "*.log\n",
+		"app.log":        "",
+		"sub/.gitignore": "!keep.log\n",
+		"sub/keep.log":   "",
+		"sub/other.log":  "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &Agent{tools: make(map[string]Tool), dir: dir}
+	registerListFilesTool(a)
+	result, err := a.tools["list_files"].Execute(map[string]interface{}{"path": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []FileInfo
+	if err := json.Unmarshal([]byte(result), &listed); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, f := range listed {
+		rel, _ := filepath.Rel(dir, f.Path)
+		seen[rel] = true
+	}
+
+	if !seen[filepath.Join("sub", "keep.log")] {
+		t.Errorf("sub/keep.log isn't listed although sub/.gitignore un-ignores it, got %v", seen)
+	}
+	for _, name := range []string{"app.log", filepath.Join("sub", "other.log")} {
+		if seen[name] {
+			t.Errorf("%s is listed although the root .gitignore ignores it", name)
+		}
+	}
+}
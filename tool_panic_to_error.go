@@ -0,0 +1,456 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+)
+
+// panicRewrite collects the edits converting a function's panics into
+// returned errors, across all files of its package
+type panicRewrite struct {
+	fset     *token.FileSet
+	info     *types.Info
+	pkg      *types.Package
+	sources  map[string][]byte
+	edits    map[string][]textEdit
+	imports  map[string]map[string]bool
+	warnings []string
+}
+
+func (r *panicRewrite) filename(pos token.Pos) string {
+	return r.fset.Position(pos).Filename
+}
+
+func (r *panicRewrite) offset(pos token.Pos) int {
+	return r.fset.Position(pos).Offset
+}
+
+func (r *panicRewrite) text(node ast.Node) string {
+	src := r.sources[r.filename(node.Pos())]
+	return string(src[r.offset(node.Pos()):r.offset(node.End())])
+}
+
+func (r *panicRewrite) indent(pos token.Pos) string {
+	return lineIndent(r.sources[r.filename(pos)], r.offset(pos))
+}
+
+func (r *panicRewrite) edit(start, end token.Pos, text string) {
+	name := r.filename(start)
+	r.edits[name] = append(r.edits[name], textEdit{Start: r.offset(start), End: r.offset(end), Text: text})
+}
+
+func (r *panicRewrite) warn(pos token.Pos, format string, args ...interface{}) {
+	r.warnings = append(r.warnings, positionString(r.fset, pos)+": "+fmt.Sprintf(format, args...))
+}
+
+func (r *panicRewrite) needImport(pos token.Pos, pkgPath string) {
+	name := r.filename(pos)
+	if r.imports[name] == nil {
+		r.imports[name] = make(map[string]bool)
+	}
+	r.imports[name][pkgPath] = true
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// returnsError reports whether the last result of sig is an error
+func returnsError(sig *types.Signature) bool {
+	results := sig.Results()
+	return results.Len() > 0 && types.Identical(results.At(results.Len()-1).Type(), errorType)
+}
+
+// zeroValue returns the Go source for the zero value of t
+func zeroValue(t types.Type, pkg *types.Package) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		}
+		return "nil"
+	case *types.Struct, *types.Array:
+		return types.TypeString(t, types.RelativeTo(pkg)) + "{}"
+	}
+	return "nil"
+}
+
+// zeroValues returns the zero values for the first n results of sig
+func zeroValues(sig *types.Signature, n int, pkg *types.Package) []string {
+	var zeros []string
+	for i := 0; i < n; i++ {
+		zeros = append(zeros, zeroValue(sig.Results().At(i).Type(), pkg))
+	}
+	return zeros
+}
+
+// panicErrorExpr converts the argument of a panic into an error expression
+func (r *panicRewrite) panicErrorExpr(call *ast.CallExpr) string {
+	if len(call.Args) != 1 {
+		r.needImport(call.Pos(), "errors")
+		return `errors.New("panic")`
+	}
+	arg := call.Args[0]
+	argType := r.info.TypeOf(arg)
+	switch {
+	case argType != nil && types.Implements(argType, errorType.Underlying().(*types.Interface)):
+		return r.text(arg)
+	case argType != nil && isStringType(argType):
+		r.needImport(call.Pos(), "errors")
+		return "errors.New(" + r.text(arg) + ")"
+	}
+	r.needImport(call.Pos(), "fmt")
+	return `fmt.Errorf("%v", ` + r.text(arg) + ")"
+}
+
+// isPanicCall reports whether stmt is a call to the builtin panic
+func isPanicCall(stmt ast.Stmt, info *types.Info) (*ast.CallExpr, bool) {
+	exprStmt, ok := stmt.(*ast.ExprStmt)
+	if !ok {
+		return nil, false
+	}
+	call, ok := exprStmt.X.(*ast.CallExpr)
+	if !ok {
+		return nil, false
+	}
+	ident, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return nil, false
+	}
+	_, builtin := info.Uses[ident].(*types.Builtin)
+	return call, builtin && ident.Name == "panic"
+}
+
+// rewriteFunc rewrites the panics and returns in fd and its signature.
+// It returns false if the function can't be converted mechanically.
+func (r *panicRewrite) rewriteFunc(fd *ast.FuncDecl, sig *types.Signature) bool {
+	alreadyReturnsError := returnsError(sig)
+	results := sig.Results().Len()
+	keep := results
+	if alreadyReturnsError {
+		keep--
+	}
+	zeros := zeroValues(sig, keep, r.pkg)
+
+	panics := 0
+	ok := true
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			ast.Inspect(n.Body, func(c ast.Node) bool {
+				if stmt, isStmt := c.(ast.Stmt); isStmt {
+					if _, isPanic := isPanicCall(stmt, r.info); isPanic {
+						r.warn(stmt.Pos(), "panic inside a function literal can't return from %s, left unchanged", fd.Name.Name)
+					}
+				}
+				return true
+			})
+			return false
+		case *ast.ExprStmt:
+			call, isPanic := isPanicCall(n, r.info)
+			if !isPanic {
+				return true
+			}
+			panics++
+			values := append(append([]string{}, zeros...), r.panicErrorExpr(call))
+			r.edit(n.Pos(), n.End(), "return "+strings.Join(values, ", "))
+		case *ast.ReturnStmt:
+			if alreadyReturnsError {
+				return true
+			}
+			switch {
+			case len(n.Results) == 0 && results == 0:
+				r.edit(n.Pos(), n.End(), "return nil")
+			case len(n.Results) == 0:
+				// Naked return with named results also returns the new named error
+			case len(n.Results) == results:
+				r.edit(n.End(), n.End(), ", nil")
+			default:
+				r.warn(n.Pos(), "return of a multi-value call can't get an error appended mechanically")
+				ok = false
+			}
+		}
+		return true
+	})
+
+	if panics == 0 {
+		r.warn(fd.Pos(), "no panic calls found directly in %s", fd.Name.Name)
+		return false
+	}
+	if !ok || alreadyReturnsError {
+		return ok
+	}
+
+	// Add the error result to the signature
+	fields := fd.Type.Results
+	switch {
+	case fields == nil || len(fields.List) == 0:
+		r.edit(fd.Type.End(), fd.Type.End(), " error")
+	case len(fields.List[0].Names) > 0:
+		errName := "err"
+		if fd.Body != nil && identUsed(fd, "err") {
+			errName = "retErr"
+		}
+		r.edit(fields.Closing, fields.Closing, ", "+errName+" error")
+	case !fields.Opening.IsValid():
+		r.edit(fields.Pos(), fields.End(), "("+r.text(fields)+", error)")
+	default:
+		r.edit(fields.Closing, fields.Closing, ", error")
+	}
+
+	// Functions without results may fall off the end of the body
+	if results == 0 {
+		last := len(fd.Body.List) - 1
+		falls := last < 0
+		if !falls {
+			_, isReturn := fd.Body.List[last].(*ast.ReturnStmt)
+			_, isPanic := isPanicCall(fd.Body.List[last], r.info)
+			falls = !isReturn && !isPanic
+		}
+		if falls {
+			src := r.sources[r.filename(fd.Pos())]
+			rbrace := r.offset(fd.Body.Rbrace)
+			lineStart := strings.LastIndexByte(string(src[:rbrace]), '\n') + 1
+			name := r.filename(fd.Pos())
+			r.edits[name] = append(r.edits[name], textEdit{Start: lineStart, End: lineStart, Text: r.indent(fd.Pos()) + "\treturn nil\n"})
+		}
+	}
+
+	return true
+}
+
+// identUsed reports whether an identifier with the given name appears in node
+func identUsed(node ast.Node, name string) bool {
+	used := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+			used = true
+		}
+		return !used
+	})
+	return used
+}
+
+// errorHandler returns the statement handling err inside the function
+// enclosing a call site
+func (r *panicRewrite) errorHandler(stack []ast.Node, target *ast.FuncDecl, targetResults int) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		var sig *types.Signature
+		switch fn := stack[i].(type) {
+		case *ast.FuncLit:
+			sig, _ = r.info.TypeOf(fn).(*types.Signature)
+		case *ast.FuncDecl:
+			if fn == target {
+				// Recursive call, the target returns an error after the rewrite
+				zeros := zeroValues(r.info.Defs[fn.Name].Type().(*types.Signature), targetResults, r.pkg)
+				return "return " + strings.Join(append(zeros, "err"), ", ")
+			}
+			if obj := r.info.Defs[fn.Name]; obj != nil {
+				sig, _ = obj.Type().(*types.Signature)
+			}
+		default:
+			continue
+		}
+		if sig != nil && returnsError(sig) {
+			zeros := zeroValues(sig, sig.Results().Len()-1, r.pkg)
+			return "return " + strings.Join(append(zeros, "err"), ", ")
+		}
+		r.warn(stack[len(stack)-1].Pos(), "caller doesn't return an error, the error is re-panicked there")
+		return "panic(err)"
+	}
+	return "panic(err)"
+}
+
+// rewriteCallers updates the call sites of the target function to handle
+// the new error result
+func (r *panicRewrite) rewriteCallers(files []*ast.File, target *ast.FuncDecl, targetObj types.Object, results int) {
+	for _, file := range files {
+		var stack []ast.Node
+		ast.Inspect(file, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			stack = append(stack, n)
+
+			var ident *ast.Ident
+			switch fn := n.(type) {
+			case *ast.Ident:
+				if r.info.Uses[fn] == targetObj && len(stack) >= 2 {
+					// Identifiers that are the function of a call are handled below
+					parent := stack[len(stack)-2]
+					if sel, ok := parent.(*ast.SelectorExpr); ok && sel.Sel == fn && len(stack) >= 3 {
+						parent = stack[len(stack)-3]
+						if call, ok := parent.(*ast.CallExpr); ok && call.Fun == sel {
+							return true
+						}
+					} else if call, ok := parent.(*ast.CallExpr); ok && call.Fun == fn {
+						return true
+					}
+					r.warn(fn.Pos(), "%s is used as a value, its type changes and needs manual attention", fn.Name)
+				}
+				return true
+			case *ast.CallExpr:
+				switch f := fn.Fun.(type) {
+				case *ast.Ident:
+					ident = f
+				case *ast.SelectorExpr:
+					ident = f.Sel
+				}
+			}
+			if ident == nil || r.info.Uses[ident] != targetObj {
+				return true
+			}
+			call := n.(*ast.CallExpr)
+
+			parent := stack[len(stack)-2]
+			indent := r.indent(call.Pos())
+			switch p := parent.(type) {
+			case *ast.ExprStmt:
+				handler := r.errorHandler(stack, target, results)
+				blanks := strings.Repeat("_, ", results)
+				r.edit(p.Pos(), p.End(), fmt.Sprintf("if %serr := %s; err != nil {\n%s\t%s\n%s}", blanks, r.text(call), indent, handler, indent))
+			case *ast.AssignStmt:
+				if p.Tok != token.DEFINE || len(p.Rhs) != 1 {
+					r.warn(call.Pos(), "assignment from %s needs an err variable declared, handle the error manually", ident.Name)
+					return true
+				}
+				handler := r.errorHandler(stack, target, results)
+				r.edit(p.Lhs[len(p.Lhs)-1].End(), p.Lhs[len(p.Lhs)-1].End(), ", err")
+				r.edit(p.End(), p.End(), fmt.Sprintf("\n%sif err != nil {\n%s\t%s\n%s}", indent, indent, handler, indent))
+			case *ast.ReturnStmt:
+				// return f() keeps compiling when the caller returns the same results plus an error
+				for i := len(stack) - 1; i >= 0; i-- {
+					if fd, ok := stack[i].(*ast.FuncDecl); ok {
+						if sig, ok := r.info.Defs[fd.Name].Type().(*types.Signature); ok && len(p.Results) == 1 &&
+							(fd == target || (returnsError(sig) && sig.Results().Len() == results+1)) {
+							return true
+						}
+						break
+					}
+				}
+				r.warn(call.Pos(), "return of %s needs its error handled manually", ident.Name)
+			default:
+				r.warn(call.Pos(), "call to %s is used inside an expression, handle its error manually", ident.Name)
+			}
+			return true
+		})
+	}
+}
+
+func registerPanicToErrorTool(a *Agent) {
+	a.tools["panic_to_error"] = Tool{
+		Name:        "panic_to_error",
+		Description: "Rewrite the panic(...) calls of a Go function into returned errors, adding an error result to its signature and updating call sites in the same package to handle it. Sites that can't be converted mechanically are reported as warnings. Callers outside the package are not updated",
+		Writes:      true,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file containing the function",
+				},
+				"function": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the function to convert, e.g. 'parse' or 'Config.Load'",
+				},
+			},
+			"required": []string{"path", "function"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			function, ok := input["function"].(string)
+			if !ok {
+				return "", fmt.Errorf("function is required")
+			}
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			fset, file, files, err := parseGoPackage(path)
+			if err != nil {
+				return "", err
+			}
+			info := typeCheck(fset, files)
+
+			decls := findFuncDecls([]*ast.File{file}, function)
+			if len(decls) == 0 || decls[0].Body == nil {
+				return "", fmt.Errorf("function %s not found in %s", function, path)
+			}
+			fd := decls[0]
+			obj := info.Defs[fd.Name]
+			if obj == nil {
+				return "", fmt.Errorf("could not type-check %s", function)
+			}
+			sig := obj.Type().(*types.Signature)
+
+			r := &panicRewrite{
+				fset:    fset,
+				info:    info,
+				pkg:     obj.Pkg(),
+				sources: make(map[string][]byte),
+				edits:   make(map[string][]textEdit),
+				imports: make(map[string]map[string]bool),
+			}
+			for _, f := range files {
+				name := fset.Position(f.Pos()).Filename
+				src, err := os.ReadFile(name)
+				if err != nil {
+					return "", fmt.Errorf("error reading file: %v", err)
+				}
+				r.sources[name] = src
+			}
+
+			if !r.rewriteFunc(fd, sig) {
+				return "Nothing rewritten:\n" + strings.Join(r.warnings, "\n"), nil
+			}
+			if !returnsError(sig) {
+				r.rewriteCallers(files, fd, obj, sig.Results().Len())
+			}
+
+			var changed, rejected []string
+			for _, f := range files {
+				name := fset.Position(f.Pos()).Filename
+				edits := r.edits[name]
+				if len(edits) == 0 {
+					continue
+				}
+				for pkgPath := range r.imports[name] {
+					if edit, ok := addImportEdit(fset, f, pkgPath); ok {
+						edits = append(edits, edit)
+					}
+				}
+				newContent := formatIfClean(r.sources[name], applyEdits(r.sources[name], edits))
+				if err := writeWithConfirmation(name, newContent, a.writeOptions()); err != nil {
+					if errors.Is(err, errChangeRejected) {
+						rejected = append(rejected, name)
+						continue
+					}
+					return "", err
+				}
+				changed = append(changed, name)
+			}
+
+			result := fmt.Sprintf("Changes applied to %s", strings.Join(changed, ", "))
+			if len(rejected) > 0 {
+				result += fmt.Sprintf("\nChanges rejected by user for %s", strings.Join(rejected, ", "))
+			}
+			if len(r.warnings) > 0 {
+				result += "\nWarnings, these sites need manual attention:\n" + strings.Join(r.warnings, "\n")
+			}
+			return result, nil
+		},
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"runtime"
+)
+
+type RangeCopyFinding struct {
+	Location   string `json:"location"`
+	Variable   string `json:"variable"`
+	Type       string `json:"type"`
+	Size       int64  `json:"size"`
+	Suggestion string `json:"suggestion"`
+}
+
+func registerRangeCopyAuditTool(a *Agent) {
+	a.tools["range_copy_audit"] = Tool{
+		Name:        "range_copy_audit",
+		Description: "Find 'for _, v := range slice' loops where v is a large struct copied on every iteration, and suggest using the index or &slice[i] instead. Reports the struct size so the change can be judged",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file or directory to scan. Directories are scanned recursively",
+				},
+				"min_size": map[string]interface{}{
+					"type":        "integer",
+					"description": "Only report values of at least this many bytes (default: 128)",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			minSize := int64(128)
+			if size, ok := input["min_size"].(float64); ok && size > 0 {
+				minSize = int64(size)
+			}
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			fset, files, err := parseGoFiles(path)
+			if err != nil {
+				return "", err
+			}
+			info := typeCheck(fset, files)
+			sizes := types.SizesFor("gc", runtime.GOARCH)
+
+			findings := []RangeCopyFinding{}
+			for _, file := range files {
+				ast.Inspect(file, func(n ast.Node) bool {
+					rs, ok := n.(*ast.RangeStmt)
+					if !ok || rs.Value == nil {
+						return true
+					}
+					value, ok := rs.Value.(*ast.Ident)
+					if !ok || value.Name == "_" {
+						return true
+					}
+
+					// Only slices and arrays can be addressed by index
+					rangeType := info.TypeOf(rs.X)
+					if rangeType == nil {
+						return true
+					}
+					if ptr, ok := rangeType.Underlying().(*types.Pointer); ok {
+						rangeType = ptr.Elem()
+					}
+					switch rangeType.Underlying().(type) {
+					case *types.Slice, *types.Array:
+					default:
+						return true
+					}
+
+					valueType := info.TypeOf(value)
+					if valueType == nil {
+						return true
+					}
+					if _, ok := valueType.Underlying().(*types.Struct); !ok {
+						return true
+					}
+					size := sizes.Sizeof(valueType)
+					if size < minSize {
+						return true
+					}
+
+					index := "i"
+					if key, ok := rs.Key.(*ast.Ident); ok && key.Name != "_" {
+						index = key.Name
+					}
+					findings = append(findings, RangeCopyFinding{
+						Location: positionString(fset, rs.Pos()),
+						Variable: value.Name,
+						Type:     types.TypeString(valueType, types.RelativeTo(nil)),
+						Size:     size,
+						Suggestion: fmt.Sprintf("for %s := range %s { %s := &%s[%s] ... } avoids copying %d bytes per iteration",
+							index, types.ExprString(rs.X), value.Name, types.ExprString(rs.X), index, size),
+					})
+					return true
+				})
+			}
+
+			result, err := json.Marshal(findings)
+			return string(result), err
+		},
+	}
+}
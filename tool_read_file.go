@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"unicode/utf8"
 )
 
+// DefaultMaxReadSize is how many bytes read_file returns at most by default
+const DefaultMaxReadSize = 100 * 1024
+
 func registerReadFileTool(a *Agent) {
 	a.tools["read_file"] = Tool{
 		Name:        "read_file",
-		Description: "Read the contents of a file",
+		Description: "Read the contents of a file, or a range of its lines. Large files are truncated, read them in line ranges",
 		InputSchema: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -16,12 +24,23 @@ func registerReadFileTool(a *Agent) {
 					"type":        "string",
 					"description": "The path to the file to read",
 				},
+				"start_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "First line to read, starting at 1 (default: 1)",
+				},
+				"end_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "Last line to read, inclusive (default: the end of the file)",
+				},
 			},
 		},
 		Execute: func(input map[string]interface{}) (string, error) {
-			path := input["path"].(string)
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
 
-			if !isPathSafe(path) {
+			if !a.isPathSafe(path) {
 				return "", os.ErrPermission
 			}
 
@@ -29,7 +48,85 @@ func registerReadFileTool(a *Agent) {
 			if err != nil {
 				return "", err
 			}
-			return string(content), nil
+			// Binary content is only noise to the model
+			if kind := binaryKind(content); kind != "" {
+				head := content
+				if len(head) > 64 {
+					head = head[:64]
+				}
+				return fmt.Sprintf("%s looks like a binary file (%s, %d bytes), not returning its contents. The first bytes are:\n%s",
+					path, kind, len(content), hex.Dump(head)), nil
+			}
+			text := string(content)
+
+			startLine, endLine := 1, 0
+			if start, ok := input["start_line"].(float64); ok && start > 1 {
+				startLine = int(start)
+			}
+			if end, ok := input["end_line"].(float64); ok && end > 0 {
+				endLine = int(end)
+			}
+			if startLine > 1 || endLine > 0 {
+				lines := strings.SplitAfter(text, "\n")
+				if lines[len(lines)-1] == "" {
+					lines = lines[:len(lines)-1]
+				}
+				if startLine > len(lines) {
+					return "", fmt.Errorf("start_line %d is past the end of the file, which has %d lines", startLine, len(lines))
+				}
+				if endLine == 0 || endLine > len(lines) {
+					endLine = len(lines)
+				}
+				if startLine > endLine {
+					return "", fmt.Errorf("start_line %d is after end_line %d", startLine, endLine)
+				}
+				text = strings.Join(lines[startLine-1:endLine], "")
+			}
+
+			return truncateRead(text, startLine, a.maxReadSize), nil
 		},
 	}
-}
\ No newline at end of file
+}
+
+// truncateRead shortens text that starts at startLine to at most max bytes,
+// noting where to continue reading. A max of 0 or less means no limit.
+func truncateRead(text string, startLine, max int) string {
+	if max <= 0 || len(text) <= max {
+		return text
+	}
+
+	// Cut at a line break so the model can continue from the next line
+	shown := text[:max]
+	i := strings.LastIndex(shown, "\n")
+	if i < 0 {
+		// Not even the first line fits, so there's no line to continue from
+		for max > 0 && !utf8.RuneStart(text[max]) {
+			max--
+		}
+		lineLen := strings.IndexByte(text, '\n')
+		if lineLen < 0 {
+			lineLen = len(text)
+		}
+		return fmt.Sprintf("%s\n[truncated: line %d is one long line of %d bytes and only its first %d are shown. Search inside it with ripgrep instead]",
+			text[:max], startLine, lineLen, max)
+	}
+	shown = shown[:i+1]
+	lastLine := startLine + strings.Count(shown, "\n") - 1
+	return fmt.Sprintf("%s\n[truncated: %d of %d bytes shown, lines %d-%d. Read the rest with start_line %d and end_line]",
+		shown, len(shown), len(text), startLine, lastLine, lastLine+1)
+}
+
+// binaryKind describes why content isn't text, or returns "" if it is
+func binaryKind(content []byte) string {
+	head := content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	switch {
+	case bytes.IndexByte(head, 0) != -1:
+		return "it contains NUL bytes"
+	case !utf8.Valid(content):
+		return "it isn't valid UTF-8"
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// maxReadFilesTotal bounds the bytes read_files returns across all files
+const maxReadFilesTotal = 4 * DefaultMaxReadSize
+
+func registerReadFilesTool(a *Agent) {
+	a.tools["read_files"] = Tool{
+		Name:        "read_files",
+		Description: "Read several files at once, returning a JSON object of path to contents. Prefer it over several read_file calls when you need a few related files. Large files are truncated, and once the total size cap is reached the remaining files are skipped",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"paths": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "The paths of the files to read",
+				},
+			},
+			"required": []string{"paths"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			paths, _ := input["paths"].([]interface{})
+			if len(paths) == 0 {
+				return "", fmt.Errorf("paths is required")
+			}
+
+			// Failures are reported per file so one bad path doesn't lose
+			// the others
+			contents := make(map[string]string)
+			remaining := maxReadFilesTotal
+			for _, p := range paths {
+				path, ok := p.(string)
+				if !ok || path == "" {
+					continue
+				}
+				if !a.isPathSafe(path) {
+					contents[path] = "Error: " + os.ErrPermission.Error()
+					continue
+				}
+				if remaining <= 0 {
+					contents[path] = fmt.Sprintf("[skipped: the total size cap of %d bytes was reached, read it separately]", maxReadFilesTotal)
+					continue
+				}
+
+				content, err := os.ReadFile(path)
+				if err != nil {
+					contents[path] = "Error: " + err.Error()
+					continue
+				}
+				if kind := binaryKind(content); kind != "" {
+					contents[path] = fmt.Sprintf("[binary file (%s, %d bytes), not returning its contents]", kind, len(content))
+					continue
+				}
+
+				limit := remaining
+				if a.maxReadSize > 0 && a.maxReadSize < limit {
+					limit = a.maxReadSize
+				}
+				text := truncateRead(string(content), 1, limit)
+				contents[path] = text
+				remaining -= len(text)
+			}
+
+			result, err := json.Marshal(contents)
+			return string(result), err
+		},
+	}
+}
@@ -2,16 +2,218 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
+type RipgrepMatch struct {
+	Path       string `json:"path"`
+	LineNumber int    `json:"line_number"`
+	Text       string `json:"text"`
+}
+
+// parseRipgrepJSON decodes the event stream of rg --json into a flat list of matches
+func parseRipgrepJSON(output []byte) (string, error) {
+	matches := []RipgrepMatch{}
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var event struct {
+			Type string `json:"type"`
+			Data struct {
+				Path struct {
+					Text string `json:"text"`
+				} `json:"path"`
+				Lines struct {
+					Text string `json:"text"`
+				} `json:"lines"`
+				LineNumber int `json:"line_number"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return "", fmt.Errorf("error decoding ripgrep output: %v", err)
+		}
+		if event.Type != "match" {
+			continue
+		}
+		matches = append(matches, RipgrepMatch{
+			Path:       event.Data.Path.Text,
+			LineNumber: event.Data.LineNumber,
+			Text:       strings.TrimRight(event.Data.Lines.Text, "\r\n"),
+		})
+	}
+
+	result, err := json.Marshal(matches)
+	return string(result), err
+}
+
+// runRipgrep executes rg with args and returns its output. found is false
+// when ripgrep reports that nothing matched.
+func runRipgrep(args []string) (output string, found bool, err error) {
+	cmd := exec.Command("rg", args...)
+	
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	
+	err = cmd.Run()
+	if err != nil {
+		// If no matches found, ripgrep exits with code 1, which is not a real error
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return "", false, nil
+		}
+		
+		if stderr.Len() > 0 {
+			return "", false, fmt.Errorf("ripgrep error: %s - %s", err, stderr.String())
+		}
+		return "", false, err
+	}
+	
+	return stdout.String(), true, nil
+}
+
+// ripgrepReplaceFiles applies a ripgrep replacement to every matching file,
+// showing a diff for each one through writeWithConfirmation
+func ripgrepReplaceFiles(a *Agent, matchArgs []string, pattern, path, replace string) (string, error) {
+	listArgs := append(append([]string{}, matchArgs...), "-l", pattern, path)
+	output, found, err := runRipgrep(listArgs)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "No matches found.", nil
+	}
+	
+	var changed, rejected []string
+	for _, file := range strings.Split(strings.TrimSpace(output), "\n") {
+		if file == "" || !a.isPathSafe(file) {
+			continue
+		}
+		
+		original, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("error reading file %s: %v", file, err)
+		}
+		
+		// --passthru prints every line, so the output is the whole file with replacements applied
+		replaceArgs := append(append([]string{}, matchArgs...), "--passthru", "--no-filename", "-N", "-r", replace, pattern, file)
+		newContent, _, err := runRipgrep(replaceArgs)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.HasSuffix(original, []byte("\n")) {
+			newContent = strings.TrimSuffix(newContent, "\n")
+		}
+		if newContent == string(original) {
+			continue
+		}
+		
+		if err := writeWithConfirmation(file, []byte(newContent), a.writeOptions()); err != nil {
+			if errors.Is(err, errChangeRejected) {
+				rejected = append(rejected, file)
+				continue
+			}
+			return "", err
+		}
+		changed = append(changed, file)
+	}
+	
+	if len(changed) == 0 && len(rejected) == 0 {
+		return "No changes to apply.", nil
+	}
+	result := fmt.Sprintf("Changes applied to %d files:\n%s", len(changed), strings.Join(changed, "\n"))
+	if len(rejected) > 0 {
+		result += fmt.Sprintf("\nChanges rejected by user for %d files:\n%s", len(rejected), strings.Join(rejected, "\n"))
+	}
+	return result, nil
+}
+
+// rebaseIgnorePattern rewrites a pattern of the ignore file in dir, relative
+// to the working directory, so that it matches the same paths when ripgrep
+// matches it relative to the working directory
+func rebaseIgnorePattern(pattern, dir string) string {
+	dir = filepath.ToSlash(dir)
+	if dir == "." {
+		return pattern
+	}
+	negate := ""
+	if strings.HasPrefix(pattern, "!") {
+		negate, pattern = "!", pattern[1:]
+	}
+	// A slash before the end anchors the pattern to dir, otherwise it
+	// matches at any depth below dir
+	if strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		return negate + "/" + dir + "/" + strings.TrimPrefix(pattern, "/")
+	}
+	return negate + "/" + dir + "/**/" + pattern
+}
+
+// haluignorePatterns collects the patterns of the .haluignore files that
+// apply to a search of path: those of the working directory and the
+// directories down to path, then those below it, so closer files come last
+// and win. ripgrep only reads .gitignore files by itself.
+func (a *Agent) haluignorePatterns(path string) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(cwd, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(filepath.ToSlash(rel), "../") {
+		// The patterns can't be rebased onto the working directory
+		return nil, nil
+	}
+
+	var patterns []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		content, err := os.ReadFile(filepath.Join(dir, haluignoreFile))
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				patterns = append(patterns, rebaseIgnorePattern(line, dir))
+			}
+		}
+	}
+
+	dir := "."
+	add(dir)
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/") {
+		if part != "." {
+			dir = filepath.Join(dir, part)
+			add(dir)
+		}
+	}
+	err = a.walkIgnoring(rel, func(currentPath string, info os.FileInfo) error {
+		if info.IsDir() {
+			add(currentPath)
+		}
+		return nil
+	})
+	return patterns, err
+}
+
 func registerRipgrepTool(a *Agent) {
 	a.tools["ripgrep"] = Tool{
 		Name:        "ripgrep",
-		Description: "Search file contents using ripgrep (rg)",
+		Description: "Search file contents using ripgrep (rg). Files ignored by .gitignore or .haluignore are skipped",
+		Writes:      true,
+		WriteInput:  "write",
 		InputSchema: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -51,45 +253,121 @@ func registerRipgrepTool(a *Agent) {
 					"type":        "boolean",
 					"description": "Show line numbers (default: true)",
 				},
+				"glob": map[string]interface{}{
+					"type":        []string{"string", "array"},
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Glob or list of globs to include or exclude files, e.g. '*.go' or '!vendor/**'",
+				},
+				"file_type": map[string]interface{}{
+					"type":        "string",
+					"description": "Only search files of this ripgrep type, e.g. 'go', 'js', 'py'",
+				},
+				"replace": map[string]interface{}{
+					"type":        "string",
+					"description": "Replace every match with this text, which may use capture groups like $1. Only previews the result unless write is set",
+				},
+				"write": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Apply the replacement to all matching files, showing a diff for each (default: false)",
+				},
+				"json": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Return matches as a JSON array of {path, line_number, text} objects instead of plain text (default: false)",
+				},
 			},
 			"required": []string{"pattern", "path"},
 		},
 		Execute: func(input map[string]interface{}) (string, error) {
-			pattern := input["pattern"].(string)
-			path := input["path"].(string)
+			pattern, ok := input["pattern"].(string)
+			if !ok {
+				return "", fmt.Errorf("pattern is required")
+			}
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
 			
-			if !isPathSafe(path) {
+			if !a.isPathSafe(path) {
 				return "", os.ErrPermission
 			}
 			
-			// Build command with safe options
-			args := []string{"--color", "never"}
+			// Build command with safe options. Matching options are kept separate
+			// from output options so they can be reused when applying replacements.
+			matchArgs := []string{"--color", "never"}
+			
+			// ripgrep has no option to look for .haluignore in every
+			// directory, so the files that apply are passed as one
+			ignorePatterns, err := a.haluignorePatterns(path)
+			if err != nil {
+				return "", err
+			}
+			if len(ignorePatterns) > 0 {
+				ignoreFile, err := os.CreateTemp("", "halu-ignore-*")
+				if err != nil {
+					return "", fmt.Errorf("error creating ignore file: %v", err)
+				}
+				defer os.Remove(ignoreFile.Name())
+				_, err = ignoreFile.WriteString(strings.Join(ignorePatterns, "\n") + "\n")
+				ignoreFile.Close()
+				if err != nil {
+					return "", fmt.Errorf("error writing ignore file: %v", err)
+				}
+				matchArgs = append(matchArgs, "--ignore-file", ignoreFile.Name())
+			}
 			
 			// Process safe options
 			if caseSensitive, ok := input["case_sensitive"].(bool); ok && caseSensitive {
-				args = append(args, "-s")
+				matchArgs = append(matchArgs, "-s")
 			} else {
-				args = append(args, "-i") // Default to case-insensitive
+				matchArgs = append(matchArgs, "-i") // Default to case-insensitive
 			}
 			
 			if literal, ok := input["literal"].(bool); ok && literal {
-				args = append(args, "-F")
+				matchArgs = append(matchArgs, "-F")
 			}
 			
-			if contextLines, ok := input["context_lines"].(float64); ok && contextLines > 0 {
-				args = append(args, fmt.Sprintf("-C%d", int(contextLines)))
+			if wordRegexp, ok := input["word_regexp"].(bool); ok && wordRegexp {
+				matchArgs = append(matchArgs, "-w")
 			}
 			
-			if wordRegexp, ok := input["word_regexp"].(bool); ok && wordRegexp {
-				args = append(args, "-w")
+			if maxDepth, ok := input["max_depth"].(float64); ok && maxDepth >= 0 {
+				matchArgs = append(matchArgs, fmt.Sprintf("--max-depth=%d", int(maxDepth)))
 			}
 			
-			if filesWithMatches, ok := input["files_with_matches"].(bool); ok && filesWithMatches {
-				args = append(args, "-l")
+			// Each glob becomes its own --glob argument
+			switch glob := input["glob"].(type) {
+			case string:
+				if glob != "" {
+					matchArgs = append(matchArgs, "--glob", glob)
+				}
+			case []interface{}:
+				for _, g := range glob {
+					if gs, ok := g.(string); ok && gs != "" {
+						matchArgs = append(matchArgs, "--glob", gs)
+					}
+				}
 			}
 			
-			if maxDepth, ok := input["max_depth"].(float64); ok && maxDepth >= 0 {
-				args = append(args, fmt.Sprintf("--max-depth=%d", int(maxDepth)))
+			if fileType, ok := input["file_type"].(string); ok && fileType != "" {
+				matchArgs = append(matchArgs, "-t", fileType)
+			}
+			
+			replace, hasReplace := input["replace"].(string)
+			if write, ok := input["write"].(bool); ok && write {
+				if !hasReplace {
+					return "", fmt.Errorf("write requires replace to be set")
+				}
+				return ripgrepReplaceFiles(a, matchArgs, pattern, path, replace)
+			}
+			
+			args := append([]string{}, matchArgs...)
+			
+			if contextLines, ok := input["context_lines"].(float64); ok && contextLines > 0 {
+				args = append(args, fmt.Sprintf("-C%d", int(contextLines)))
+			}
+			
+			if filesWithMatches, ok := input["files_with_matches"].(bool); ok && filesWithMatches {
+				args = append(args, "-l")
 			}
 			
 			// Line numbers are shown by default, unless explicitly disabled
@@ -101,30 +379,31 @@ func registerRipgrepTool(a *Agent) {
 				args = append(args, "-N")
 			}
 			
-			// Add pattern and path as the last arguments
-			args = append(args, pattern, path)
+			jsonOutput, _ := input["json"].(bool)
+			if jsonOutput {
+				args = append(args, "--json")
+			}
 			
-			// Execute ripgrep command
-			cmd := exec.Command("rg", args...)
+			// Preview replacements without touching any files
+			if hasReplace {
+				args = append(args, "-r", replace)
+			}
 			
-			var stdout, stderr bytes.Buffer
-			cmd.Stdout = &stdout
-			cmd.Stderr = &stderr
+			// Add pattern and path as the last arguments
+			args = append(args, pattern, path)
 			
-			err := cmd.Run()
+			result, found, err := runRipgrep(args)
 			if err != nil {
-				// If no matches found, ripgrep exits with code 1, which is not a real error
-				if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-					return "No matches found.", nil
-				}
-				
-				if stderr.Len() > 0 {
-					return "", fmt.Errorf("ripgrep error: %s - %s", err, stderr.String())
-				}
 				return "", err
 			}
+			if !found {
+				return "No matches found.", nil
+			}
+			
+			if jsonOutput {
+				return parseRipgrepJSON([]byte(result))
+			}
 			
-			result := stdout.String()
 			if strings.TrimSpace(result) == "" {
 				return "No matches found.", nil
 			}
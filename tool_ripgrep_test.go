@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRebaseIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern, dir, want string
+	}{
+		{"*.log", ".", "*.log"},
+		{"/build", ".", "/build"},
+		{"*.log", "sub", "/sub/**/*.log"},
+		{"build/", "sub", "/sub/**/build/"},
+		{"/build", "sub", "/sub/build"},
+		{"gen/out", "a/b", "/a/b/gen/out"},
+		{"!keep.log", "sub", "!/sub/**/keep.log"},
+		{"!/keep.log", "sub", "!/sub/keep.log"},
+	}
+	for _, tt := range tests {
+		if got := rebaseIgnorePattern(tt.pattern, tt.dir); got != tt.want {
+			t.Errorf("rebaseIgnorePattern(%q, %q) = %q, want %q", tt.pattern, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestHaluignorePatterns(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	files := map[string]string{
+		".haluignore":                  "*.log\n# a comment\n",
+		"a/.haluignore":                "/secret.txt\n",
+		"a/b/.haluignore":              "!keep.log\n",
+		"a/b/main.go":                  "",
+		"other/.haluignore":            "*.txt\n",
+		"a/b/ignored/.gitignore":       "*\n",
+		"a/b/.gitignore":               "ignored/\n",
+		"a/b/ignored/deep/.haluignore": "*.go\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &Agent{dir: dir}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{".", []string{"*.log", "/a/secret.txt", "!/a/b/**/keep.log", "/other/**/*.txt"}},
+		// Only the files above the search and below it apply
+		{"a/b", []string{"*.log", "/a/secret.txt", "!/a/b/**/keep.log"}},
+		{"a/b/main.go", []string{"*.log", "/a/secret.txt", "!/a/b/**/keep.log"}},
+		{"other", []string{"*.log", "/other/**/*.txt"}},
+	}
+	for _, tt := range tests {
+		got, err := a.haluignorePatterns(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("haluignorePatterns(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -1,31 +1,146 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"strings"
 )
 
+// SearchMatch is one location a search text was found at
+type SearchMatch struct {
+	Line int    // line the match starts on, starting at 1
+	Text string // that line, shortened
+}
+
+// maxReportedMatches bounds the locations listed in a SearchNotUniqueError
+const maxReportedMatches = 10
+
 type SearchNotUniqueError struct {
-	Count int
+	Count   int
+	Matches []SearchMatch
 }
 
 func (e *SearchNotUniqueError) Error() string {
-	return fmt.Sprintf("search text matches %d locations - must match exactly once", e.Count)
+	var b strings.Builder
+	fmt.Fprintf(&b, "search text matches %d locations - must match exactly once. Matches start at:", e.Count)
+	for _, m := range e.Matches {
+		fmt.Fprintf(&b, "\n  line %d: %s", m.Line, m.Text)
+	}
+	if e.Count > len(e.Matches) {
+		fmt.Fprintf(&b, "\n  ... and %d more", e.Count-len(e.Matches))
+	}
+	b.WriteString("\nInclude more of the surrounding lines in search so it matches only the intended location.")
+	return b.String()
 }
 
-func countMatches(content, search string) int {
-	count := 0
+// matchOffsets returns the byte offsets of all, possibly overlapping,
+// occurrences of search in content
+func matchOffsets(content, search string) []int {
+	var offsets []int
 	pos := 0
 	for {
 		i := strings.Index(content[pos:], search)
 		if i == -1 {
 			break
 		}
-		count++
+		offsets = append(offsets, pos+i)
 		pos += i + 1
 	}
-	return count
+	return offsets
+}
+
+// searchMatches describes the locations of the offsets for an error
+func searchMatches(content string, offsets []int) []SearchMatch {
+	var matches []SearchMatch
+	for _, offset := range offsets {
+		if len(matches) == maxReportedMatches {
+			break
+		}
+		start := strings.LastIndex(content[:offset], "\n") + 1
+		end := strings.Index(content[offset:], "\n")
+		if end == -1 {
+			end = len(content)
+		} else {
+			end += offset
+		}
+		text := strings.TrimSpace(content[start:end])
+		if len(text) > 80 {
+			text = text[:77] + "..."
+		}
+		matches = append(matches, SearchMatch{
+			Line: strings.Count(content[:offset], "\n") + 1,
+			Text: text,
+		})
+	}
+	return matches
+}
+
+// leadingWhitespace returns the indentation of line
+func leadingWhitespace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// reindent moves the replacement lines to the indentation of the matched
+// lines, keeping their indentation relative to each other. Indents that
+// appear in the search text become the file's indents they matched, so
+// spaces in the search turn into the file's tabs. Deeper indents add their
+// extra levels in the file's style when it can be told from the search.
+func reindent(replaceLines, searchLines, matchedLines []string) []string {
+	// Lines kept unchanged from the search keep their indentation, other
+	// indents map to the first line that had them
+	kept := make(map[string]string)
+	indents := make(map[string]string)
+	for j, sl := range searchLines {
+		if strings.TrimSpace(sl) == "" {
+			continue
+		}
+		kept[strings.TrimRight(sl, " \t")] = leadingWhitespace(matchedLines[j])
+		if _, ok := indents[leadingWhitespace(sl)]; !ok {
+			indents[leadingWhitespace(sl)] = leadingWhitespace(matchedLines[j])
+		}
+	}
+
+	// One level of indentation in the search and in the file, from two
+	// search lines that differ by it
+	var searchUnit, fileUnit string
+	for s1, f1 := range indents {
+		for s2, f2 := range indents {
+			if len(s2) > len(s1) && strings.HasPrefix(s2, s1) && strings.HasPrefix(f2, f1) && len(f2) > len(f1) {
+				unit := s2[len(s1):]
+				if searchUnit == "" || len(unit) < len(searchUnit) {
+					searchUnit, fileUnit = unit, f2[len(f1):]
+				}
+			}
+		}
+	}
+
+	result := make([]string, len(replaceLines))
+	for j, rline := range replaceLines {
+		text := strings.TrimLeft(rline, " \t")
+		if text == "" {
+			continue
+		}
+		if indent, ok := kept[strings.TrimRight(rline, " \t")]; ok {
+			result[j] = indent + text
+			continue
+		}
+		indent := leadingWhitespace(rline)
+
+		// Start from the deepest search indent this one extends
+		base, mapped := "", leadingWhitespace(matchedLines[0])
+		for s, f := range indents {
+			if strings.HasPrefix(indent, s) && len(s) >= len(base) {
+				base, mapped = s, f
+			}
+		}
+		extra := indent[len(base):]
+		if searchUnit != "" && len(extra)%len(searchUnit) == 0 && extra == strings.Repeat(searchUnit, len(extra)/len(searchUnit)) {
+			extra = strings.Repeat(fileUnit, len(extra)/len(searchUnit))
+		}
+		result[j] = mapped + extra + text
+	}
+	return result
 }
 
 // tryRelativeIndent attempts to do search/replace while handling indentation differences
@@ -34,54 +149,48 @@ func tryRelativeIndent(content, search, replace string) (string, bool) {
 	searchLines := strings.Split(search, "\n")
 	replaceLines := strings.Split(replace, "\n")
 
-	if len(searchLines) <= 1 || len(replaceLines) <= 1 {
+	if len(searchLines) <= 1 {
 		return "", false // Only handle multi-line blocks
 	}
 
-	// Try to find the search block with flexible indentation
+	// Find the search block with flexible indentation. Like an exact
+	// search, it has to match exactly one location.
+	match := -1
 	for i := 0; i <= len(lines)-len(searchLines); i++ {
 		matched := true
-		baseIndent := ""
-
-		// Get base indentation from first line
-		if sl := strings.TrimSpace(searchLines[0]); strings.TrimSpace(lines[i]) == sl {
-			baseIndent = strings.Repeat(" ", len(lines[i])-len(strings.TrimLeft(lines[i], " ")))
-		} else {
-			continue
-		}
-
-		// Check if all lines match with consistent indentation
-		for j := 1; j < len(searchLines); j++ {
-			sl := strings.TrimSpace(searchLines[j])
-			ll := strings.TrimSpace(lines[i+j])
-			if sl != ll {
+		for j := range searchLines {
+			if strings.TrimSpace(lines[i+j]) != strings.TrimSpace(searchLines[j]) {
 				matched = false
 				break
 			}
 		}
-
-		if matched {
-			// Found a match - replace while preserving base indentation
-			result := make([]string, len(lines))
-			copy(result, lines)
-			
-			// Apply replacement with preserved indentation
-			for j, rline := range replaceLines {
-				if j < len(searchLines) {
-					result[i+j] = baseIndent + strings.TrimSpace(rline)
-				}
-			}
-			return strings.Join(result, "\n"), true
+		if !matched {
+			continue
 		}
+		if match != -1 {
+			return "", false
+		}
+		match = i
+	}
+	if match == -1 {
+		return "", false
 	}
 
-	return "", false
+	// Splice the replacement in place of the matched lines, whatever their
+	// numbers, preserving the file's indentation
+	matchedLines := lines[match : match+len(searchLines)]
+	result := make([]string, 0, len(lines)-len(searchLines)+len(replaceLines))
+	result = append(result, lines[:match]...)
+	result = append(result, reindent(replaceLines, searchLines, matchedLines)...)
+	result = append(result, lines[match+len(searchLines):]...)
+	return strings.Join(result, "\n"), true
 }
 
 func registerSearchReplaceTool(a *Agent) {
 	a.tools["search_replace"] = Tool{
 		Name:        "search_replace",
 		Description: "Search and replace text in a file. The search text must match exactly one location in the file.",
+		Writes:      true,
 		InputSchema: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -100,11 +209,20 @@ func registerSearchReplaceTool(a *Agent) {
 			},
 		},
 		Execute: func(input map[string]interface{}) (string, error) {
-			path := input["path"].(string)
-			searchText := input["search"].(string)
-			replaceText := input["replace"].(string)
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			searchText, ok := input["search"].(string)
+			if !ok {
+				return "", fmt.Errorf("search is required")
+			}
+			replaceText, ok := input["replace"].(string)
+			if !ok {
+				return "", fmt.Errorf("replace is required")
+			}
 
-			if !isPathSafe(path) {
+			if !a.isPathSafe(path) {
 				return "", os.ErrPermission
 			}
 
@@ -114,13 +232,17 @@ func registerSearchReplaceTool(a *Agent) {
 				return "", fmt.Errorf("error reading file: %v", err)
 			}
 
-			// Check for unique match
-			matches := countMatches(string(content), searchText)
-			if matches == 0 {
-				return "No matches found", nil
+			// Match on \n line endings, writeWithConfirmation restores \r\n
+			if usesCRLF(content) {
+				content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+				searchText = strings.ReplaceAll(searchText, "\r\n", "\n")
+				replaceText = strings.ReplaceAll(replaceText, "\r\n", "\n")
 			}
-			if matches > 1 {
-				return "", &SearchNotUniqueError{Count: matches}
+
+			// Check for unique match
+			offsets := matchOffsets(string(content), searchText)
+			if len(offsets) > 1 {
+				return "", &SearchNotUniqueError{Count: len(offsets), Matches: searchMatches(string(content), offsets)}
 			}
 
 			var newContent string
@@ -134,16 +256,16 @@ func registerSearchReplaceTool(a *Agent) {
 				matched = true
 			}
 
-			// 2. Try with relative indentation if exact match failed
+			// 2. Try with relative indentation if there is no exact match
 			if !matched {
 				newContent, matched = tryRelativeIndent(string(content), searchText, replaceText)
 			}
 
 			if !matched {
-				return "No matches found after trying various strategies", nil
+				return "No matches found", nil
 			}
 
-			err = writeWithConfirmation(path, []byte(newContent), a.yolo)
+			err = writeWithConfirmation(path, []byte(newContent), a.writeOptions())
 			if err != nil {
 				return "", err
 			}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestTryRelativeIndentNestedLoop(t *testing.T) {
+	content := "func f(items []int) {\n" +
+		"\tif len(items) > 0 {\n" +
+		"\t\tfmt.Println(items[0])\n" +
+		"\t}\n" +
+		"}\n"
+	// The model quoted the block with four-space indents
+	search := "if len(items) > 0 {\n" +
+		"    fmt.Println(items[0])\n" +
+		"}"
+	replace := "for _, item := range items {\n" +
+		"    for i := 0; i < item; i++ {\n" +
+		"        if i%2 == 0 {\n" +
+		"            fmt.Println(i)\n" +
+		"        }\n" +
+		"    }\n" +
+		"}"
+	want := "func f(items []int) {\n" +
+		"\tfor _, item := range items {\n" +
+		"\t\tfor i := 0; i < item; i++ {\n" +
+		"\t\t\tif i%2 == 0 {\n" +
+		"\t\t\t\tfmt.Println(i)\n" +
+		"\t\t\t}\n" +
+		"\t\t}\n" +
+		"\t}\n" +
+		"}\n"
+
+	got, ok := tryRelativeIndent(content, search, replace)
+	if !ok {
+		t.Fatal("tryRelativeIndent didn't match the block")
+	}
+	if got != want {
+		t.Errorf("tryRelativeIndent() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+)
+
+type SecretFinding struct {
+	Path  string `json:"path"`
+	Line  int    `json:"line"`
+	Kind  string `json:"kind"`
+	Match string `json:"match"`
+}
+
+// secretPatterns are well known shapes of credentials
+var secretPatterns = []struct {
+	Kind    string
+	Pattern *regexp.Regexp
+}{
+	{"aws_access_key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"api_key", regexp.MustCompile(`\bsk-(ant-)?[A-Za-z0-9_\-]{20,}`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`)},
+	{"private_key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY( BLOCK)?-----`)},
+}
+
+// secretAssignment matches string values assigned to suspiciously named variables
+var secretAssignment = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|access_?key|private_?key|credential)\w*["']?\s*(:=|=|:)\s*["']([^"'\s]{8,})["']`)
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	var entropy float64
+	n := float64(len([]rune(s)))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// maskSecret keeps just enough of a match to locate it without repeating the secret
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return "****"
+	}
+	return s[:4] + "****" + s[len(s)-2:]
+}
+
+// scanFileForSecrets returns potential secrets found in a single file
+func scanFileForSecrets(path string) ([]SecretFinding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var findings []SecretFinding
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		for _, sp := range secretPatterns {
+			for _, match := range sp.Pattern.FindAllString(line, -1) {
+				findings = append(findings, SecretFinding{
+					Path:  path,
+					Line:  lineNum,
+					Kind:  sp.Kind,
+					Match: maskSecret(match),
+				})
+			}
+		}
+
+		for _, m := range secretAssignment.FindAllStringSubmatch(line, -1) {
+			value := m[3]
+			// Low entropy values are usually placeholders or lookups, not secrets
+			if shannonEntropy(value) < 3.5 {
+				continue
+			}
+			findings = append(findings, SecretFinding{
+				Path:  path,
+				Line:  lineNum,
+				Kind:  "suspicious_assignment",
+				Match: m[1] + " = " + maskSecret(value),
+			})
+		}
+	}
+
+	return findings, scanner.Err()
+}
+
+func registerSecretScanTool(a *Agent) {
+	a.tools["secret_scan"] = Tool{
+		Name:        "secret_scan",
+		Description: "Scan files for potential hardcoded secrets such as API keys, tokens, private keys and high-entropy strings assigned to suspiciously named variables. Findings are potential and must be verified manually",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The file or directory to scan. Files ignored by .gitignore are skipped",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			findings := []SecretFinding{}
+			err := a.walkIgnoring(path, func(currentPath string, info os.FileInfo) error {
+				if info.IsDir() || info.Size() > 1024*1024 || isBinaryFile(currentPath) {
+					return nil
+				}
+				fileFindings, err := scanFileForSecrets(currentPath)
+				if err != nil {
+					return nil
+				}
+				findings = append(findings, fileFindings...)
+				return nil
+			})
+			if err != nil {
+				return "", err
+			}
+
+			result, err := json.Marshal(map[string]interface{}{
+				"note":     "potential secrets, verify manually",
+				"findings": findings,
+			})
+			return string(result), err
+		},
+	}
+}
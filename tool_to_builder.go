@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+)
+
+// concatStmt is a string concatenation onto a variable inside a loop
+type concatStmt struct {
+	Stmt     *ast.AssignStmt
+	Operands []ast.Expr // the values appended to the variable
+	Uses     int        // references to the variable in the statement itself
+}
+
+// concatOperands returns the values appended by stmt if it is "v += x" or
+// "v = v + x + ...", along with the concatenated variable
+func concatOperands(stmt *ast.AssignStmt, info *types.Info) (*ast.Ident, []ast.Expr, int) {
+	if len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+		return nil, nil, 0
+	}
+	lhs, ok := stmt.Lhs[0].(*ast.Ident)
+	if !ok {
+		return nil, nil, 0
+	}
+	lhsType := info.TypeOf(lhs)
+	if lhsType == nil || !isStringType(lhsType) {
+		return nil, nil, 0
+	}
+
+	// Flatten a left-associated chain of + into its operands
+	var flatten func(e ast.Expr) []ast.Expr
+	flatten = func(e ast.Expr) []ast.Expr {
+		if bin, ok := e.(*ast.BinaryExpr); ok && bin.Op == token.ADD {
+			return append(flatten(bin.X), flatten(bin.Y)...)
+		}
+		if paren, ok := e.(*ast.ParenExpr); ok {
+			return flatten(paren.X)
+		}
+		return []ast.Expr{e}
+	}
+
+	switch stmt.Tok {
+	case token.ADD_ASSIGN:
+		return lhs, flatten(stmt.Rhs[0]), 1
+	case token.ASSIGN:
+		operands := flatten(stmt.Rhs[0])
+		if len(operands) < 2 {
+			return nil, nil, 0
+		}
+		first, ok := operands[0].(*ast.Ident)
+		if !ok || info.Uses[first] != info.Uses[lhs] {
+			return nil, nil, 0
+		}
+		return lhs, operands[1:], 2
+	}
+	return nil, nil, 0
+}
+
+// hasComplexControlFlow reports whether the loop can leave by a path that
+// would skip the code placed after it
+func hasComplexControlFlow(loop ast.Node) bool {
+	complex := false
+	ast.Inspect(loop, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			complex = true
+		case *ast.BranchStmt:
+			if n.Tok == token.GOTO || n.Label != nil {
+				complex = true
+			}
+		}
+		return !complex
+	})
+	return complex
+}
+
+// toBuilderEdits computes the edits converting string concatenation in the
+// loops of fd into strings.Builder writes. Loops that can't be converted
+// safely are reported as warnings.
+func toBuilderEdits(fset *token.FileSet, src []byte, info *types.Info, fd *ast.FuncDecl, line int) ([]textEdit, []string) {
+	type loopVar struct {
+		Loop ast.Stmt
+		Obj  types.Object
+	}
+	groups := make(map[loopVar][]concatStmt)
+	var order []loopVar
+	var warnings []string
+
+	// Find concatenations and attribute them to the outermost enclosing loop
+	// that doesn't also contain the variable's declaration
+	var loops []ast.Stmt
+	var visit func(n ast.Node)
+	visit = func(n ast.Node) {
+		ast.Inspect(n, func(c ast.Node) bool {
+			switch c := c.(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+				if c == n {
+					return true
+				}
+				loops = append(loops, c.(ast.Stmt))
+				visit(c)
+				loops = loops[:len(loops)-1]
+				return false
+			case *ast.FuncLit:
+				return false
+			case *ast.AssignStmt:
+				ident, operands, uses := concatOperands(c, info)
+				if ident == nil {
+					return true
+				}
+				obj := info.Uses[ident]
+				if obj == nil || obj.Parent() == nil {
+					return true
+				}
+				var target ast.Stmt
+				for _, loop := range loops {
+					if obj.Pos() < loop.Pos() || obj.Pos() > loop.End() {
+						target = loop
+						break
+					}
+				}
+				if target == nil {
+					warnings = append(warnings, fmt.Sprintf("%s: concatenation to %s is not in a loop, left unchanged", positionString(fset, c.Pos()), ident.Name))
+					return true
+				}
+				if line > 0 && fset.Position(target.Pos()).Line != line {
+					return true
+				}
+				key := loopVar{Loop: target, Obj: obj}
+				if _, ok := groups[key]; !ok {
+					order = append(order, key)
+				}
+				groups[key] = append(groups[key], concatStmt{Stmt: c, Operands: operands, Uses: uses})
+			}
+			return true
+		})
+	}
+	visit(fd.Body)
+
+	var edits []textEdit
+	usedNames := make(map[string]bool)
+	ast.Inspect(fd, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			usedNames[ident.Name] = true
+		}
+		return true
+	})
+
+	for _, key := range order {
+		stmts := groups[key]
+		name := key.Obj.Name()
+		loopPos := positionString(fset, key.Loop.Pos())
+
+		if hasComplexControlFlow(key.Loop) {
+			warnings = append(warnings, fmt.Sprintf("%s: loop concatenating %s returns or jumps out of the loop, left unchanged", loopPos, name))
+			continue
+		}
+
+		// The variable must not be read anywhere else in the loop, since the
+		// builder holds its value until the loop ends
+		uses := 0
+		ast.Inspect(key.Loop, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && info.Uses[ident] == key.Obj {
+				uses++
+			}
+			return true
+		})
+		expected := 0
+		for _, s := range stmts {
+			expected += s.Uses
+		}
+		if uses != expected {
+			warnings = append(warnings, fmt.Sprintf("%s: %s is used inside the loop other than for concatenation, left unchanged", loopPos, name))
+			continue
+		}
+
+		builder := name + "Builder"
+		for i := 2; usedNames[builder]; i++ {
+			builder = fmt.Sprintf("%sBuilder%d", name, i)
+		}
+		usedNames[builder] = true
+
+		loopStart := fset.Position(key.Loop.Pos()).Offset
+		loopEnd := fset.Position(key.Loop.End()).Offset
+		indent := lineIndent(src, loopStart)
+		edits = append(edits,
+			textEdit{Start: loopStart, End: loopStart, Text: fmt.Sprintf("var %s strings.Builder\n%s%s.WriteString(%s)\n%s", builder, indent, builder, name, indent)},
+			textEdit{Start: loopEnd, End: loopEnd, Text: fmt.Sprintf("\n%s%s = %s.String()", indent, name, builder)},
+		)
+
+		for _, s := range stmts {
+			start := fset.Position(s.Stmt.Pos()).Offset
+			end := fset.Position(s.Stmt.End()).Offset
+			stmtIndent := lineIndent(src, start)
+			var writes []string
+			for _, operand := range s.Operands {
+				writes = append(writes, fmt.Sprintf("%s.WriteString(%s)", builder, src[fset.Position(operand.Pos()).Offset:fset.Position(operand.End()).Offset]))
+			}
+			edits = append(edits, textEdit{Start: start, End: end, Text: strings.Join(writes, "\n"+stmtIndent)})
+		}
+	}
+
+	return edits, warnings
+}
+
+func registerToBuilderTool(a *Agent) {
+	a.tools["to_builder"] = Tool{
+		Name:        "to_builder",
+		Description: "Rewrite string concatenation inside loops ('s += x' or 's = s + x') into a strings.Builder, adding the import. Concatenations outside loops or in loops with complex control flow are reported and left unchanged",
+		Writes:      true,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The Go file containing the function",
+				},
+				"function": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the function to rewrite, e.g. 'render' or 'Agent.Run'",
+				},
+				"line": map[string]interface{}{
+					"type":        "integer",
+					"description": "Only rewrite the loop starting at this line (default: all loops in the function)",
+				},
+			},
+			"required": []string{"path", "function"},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			function, ok := input["function"].(string)
+			if !ok {
+				return "", fmt.Errorf("function is required")
+			}
+			line := 0
+			if l, ok := input["line"].(float64); ok {
+				line = int(l)
+			}
+
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			src, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("error reading file: %v", err)
+			}
+			fset, file, files, err := parseGoPackage(path)
+			if err != nil {
+				return "", err
+			}
+			info := typeCheck(fset, files)
+
+			decls := findFuncDecls([]*ast.File{file}, function)
+			if len(decls) == 0 || decls[0].Body == nil {
+				return "", fmt.Errorf("function %s not found in %s", function, path)
+			}
+
+			edits, warnings := toBuilderEdits(fset, src, info, decls[0], line)
+			result := strings.Join(warnings, "\n")
+			if len(edits) == 0 {
+				if result == "" {
+					return "No string concatenation in loops found", nil
+				}
+				return "Nothing rewritten:\n" + result, nil
+			}
+
+			if edit, ok := addImportEdit(fset, file, "strings"); ok {
+				edits = append(edits, edit)
+			}
+			newContent := formatIfClean(src, applyEdits(src, edits))
+
+			if err := writeWithConfirmation(path, newContent, a.writeOptions()); err != nil {
+				return "", err
+			}
+
+			if result != "" {
+				return "Changes applied successfully, with warnings:\n" + result, nil
+			}
+			return "Changes applied successfully", nil
+		},
+	}
+}
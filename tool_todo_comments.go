@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultTodoMarkers are the markers todo_comments looks for by default
+var defaultTodoMarkers = []string{"TODO", "FIXME", "XXX", "HACK"}
+
+// maxTodos bounds the number of markers returned
+const maxTodos = 500
+
+type TodoComment struct {
+	Line   int    `json:"line"`
+	Marker string `json:"marker"`
+	Text   string `json:"text"`
+}
+
+type TodoFile struct {
+	Path  string        `json:"path"`
+	Todos []TodoComment `json:"todos"`
+}
+
+// hashCommentExts are the extensions of files whose comments start with #
+var hashCommentExts = map[string]bool{
+	".py": true, ".sh": true, ".bash": true, ".zsh": true, ".rb": true, ".pl": true,
+	".yaml": true, ".yml": true, ".toml": true, ".conf": true, ".cfg": true, ".mk": true,
+	".r": true, ".tf": true, ".nix": true, ".cmake": true, ".ps1": true,
+}
+
+// slashCommentExts are the extensions of files with // and /* */ comments
+var slashCommentExts = map[string]bool{
+	".go": true, ".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true,
+	".java": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".rs": true,
+	".swift": true, ".kt": true, ".scala": true, ".cs": true, ".css": true, ".scss": true,
+	".proto": true, ".dart": true, ".zig": true,
+}
+
+// commentScanner finds the comment text of the lines of a file. Markers in
+// string literals or code aren't comments.
+type commentScanner struct {
+	slash, hash bool   // whether // and /* */, or # start comments
+	open        string // a block comment or multi-line string left open by a previous line
+}
+
+// newCommentScanner picks the comment syntax from the file name, files it
+// can't tell get all of them
+func newCommentScanner(path string) *commentScanner {
+	base := filepath.Base(path)
+	ext := strings.ToLower(filepath.Ext(base))
+	switch {
+	case slashCommentExts[ext]:
+		return &commentScanner{slash: true}
+	case hashCommentExts[ext], base == "Makefile", base == "Dockerfile", strings.HasPrefix(base, "."):
+		return &commentScanner{hash: true}
+	}
+	return &commentScanner{slash: true, hash: true}
+}
+
+// comments returns the start and end offsets of the comment text in line
+func (s *commentScanner) comments(line string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(line); {
+		if s.open != "" {
+			closer := s.open
+			if closer == "/*" {
+				closer = "*/"
+			}
+			end := strings.Index(line[i:], closer)
+			if end < 0 {
+				end = len(line) - i
+			}
+			if s.open == "/*" {
+				spans = append(spans, [2]int{i, i + end})
+			}
+			if i+end == len(line) {
+				return spans
+			}
+			i += end + len(closer)
+			s.open = ""
+			continue
+		}
+
+		rest := line[i:]
+		switch {
+		case s.slash && strings.HasPrefix(rest, "//"), s.hash && rest[0] == '#':
+			return append(spans, [2]int{i, len(line)})
+		case s.slash && strings.HasPrefix(rest, "/*"):
+			s.open = "/*"
+			i += 2
+		case strings.HasPrefix(rest, `"""`), strings.HasPrefix(rest, "'''"):
+			s.open = rest[:3]
+			i += 3
+		case rest[0] == '`':
+			s.open = "`"
+			i++
+		case rest[0] == '"' || rest[0] == '\'':
+			// A quote that isn't closed on the line, like in Rust's 'a,
+			// is taken as a plain character
+			i += quotedLen(rest)
+		default:
+			i++
+		}
+	}
+	return spans
+}
+
+// quotedLen returns the length of the string literal at the start of s, or
+// 1 if its quote isn't closed
+func quotedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case s[0]:
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// scanFileForTodos returns the comments of a file containing one of the
+// markers
+func scanFileForTodos(path string, markers *regexp.Regexp) ([]TodoComment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var todos []TodoComment
+	comments := newCommentScanner(path)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		for _, span := range comments.comments(line) {
+			comment := line[span[0]:span[1]]
+			loc := markers.FindStringSubmatchIndex(comment)
+			if loc == nil {
+				continue
+			}
+			loc = loc[2:4]
+			text := strings.TrimSpace(comment[loc[0]:])
+			if len(text) > 200 {
+				text = text[:197] + "..."
+			}
+			todos = append(todos, TodoComment{
+				Line:   lineNum,
+				Marker: comment[loc[0]:loc[1]],
+				Text:   text,
+			})
+			break
+		}
+	}
+	return todos, scanner.Err()
+}
+
+func registerTodoCommentsTool(a *Agent) {
+	a.tools["todo_comments"] = Tool{
+		Name:        "todo_comments",
+		Description: "List TODO, FIXME, XXX and HACK comments, or other markers, found in comment text rather than strings or code, grouped by file with line numbers. Files ignored by .gitignore or .haluignore are skipped",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The file or directory to scan (default: .)",
+				},
+				"markers": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Markers to look for, matched as whole words and case sensitively (default: TODO, FIXME, XXX, HACK)",
+				},
+			},
+		},
+		Execute: func(input map[string]interface{}) (string, error) {
+			path, _ := input["path"].(string)
+			if path == "" {
+				path = "."
+			}
+			if !a.isPathSafe(path) {
+				return "", os.ErrPermission
+			}
+
+			markers := defaultTodoMarkers
+			if list, ok := input["markers"].([]interface{}); ok {
+				markers = nil
+				for _, m := range list {
+					if s, ok := m.(string); ok && s != "" {
+						markers = append(markers, regexp.QuoteMeta(s))
+					}
+				}
+				if len(markers) == 0 {
+					return "", fmt.Errorf("markers is empty, leave it out to look for TODO, FIXME, XXX and HACK")
+				}
+			}
+			// Not as part of a name like context.TODO
+			pattern, err := regexp.Compile(`(?:^|[^.\w])(` + strings.Join(markers, "|") + `)\b`)
+			if err != nil {
+				return "", err
+			}
+
+			files := []TodoFile{}
+			count := 0
+			err = a.walkIgnoring(path, func(currentPath string, info os.FileInfo) error {
+				if info.IsDir() || count >= maxTodos || info.Size() > 1024*1024 || isBinaryFile(currentPath) {
+					return nil
+				}
+				todos, err := scanFileForTodos(currentPath, pattern)
+				if err != nil || len(todos) == 0 {
+					return nil
+				}
+				if count+len(todos) > maxTodos {
+					todos = todos[:maxTodos-count]
+				}
+				count += len(todos)
+				files = append(files, TodoFile{Path: currentPath, Todos: todos})
+				return nil
+			})
+			if err != nil {
+				return "", err
+			}
+
+			output := map[string]interface{}{"count": count, "files": files}
+			if count >= maxTodos {
+				output["note"] = "stopped after the first 500 markers, scan a smaller path for the rest"
+			}
+			result, err := json.Marshal(output)
+			return string(result), err
+		},
+	}
+}
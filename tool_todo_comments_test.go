@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestScanFileForTodos(t *testing.T) {
+	tests := []struct {
+		name, content string
+		want          []TodoComment
+	}{
+		{
+			name: "main.go",
+			content: "package main\n" +
+				"\n" +
+				"// TODO: split this up\n" +
+				"var markers = []string{\"TODO\", \"FIXME\"}\n" +
+				"var quote = '\"' // FIXME quoting\n" +
+				"var raw = `\n" +
+				"HACK inside a raw string\n" +
+				"`\n" +
+				"/* XXX in a block\n" +
+				"   that goes on, TODO here too */ var x = \"HACK\"\n" +
+				"var ctx = context.TODO()\n",
+			want: []TodoComment{
+				{Line: 3, Marker: "TODO", Text: "TODO: split this up"},
+				{Line: 5, Marker: "FIXME", Text: "FIXME quoting"},
+				{Line: 9, Marker: "XXX", Text: "XXX in a block"},
+				{Line: 10, Marker: "TODO", Text: "TODO here too"},
+			},
+		},
+		{
+			name: "tool.py",
+			content: "def f():\n" +
+				"    \"\"\"TODO in a docstring\"\"\"\n" +
+				"    s = 'FIXME' # HACK around it\n" +
+				"    return s // 2  # TODO: floor\n",
+			want: []TodoComment{
+				{Line: 3, Marker: "HACK", Text: "HACK around it"},
+				{Line: 4, Marker: "TODO", Text: "TODO: floor"},
+			},
+		},
+	}
+
+	pattern := regexp.MustCompile(`(?:^|[^.\w])(TODO|FIXME|XXX|HACK)\b`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := scanFileForTodos(path, pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("scanFileForTodos() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("todo %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTodoCommentsEmptyMarkers(t *testing.T) {
+	a := &Agent{tools: make(map[string]Tool), dir: t.TempDir()}
+	registerTodoCommentsTool(a)
+	for _, markers := range [][]interface{}{{}, {""}} {
+		if _, err := a.tools["todo_comments"].Execute(map[string]interface{}{"path": a.dir, "markers": markers}); err == nil {
+			t.Errorf("todo_comments accepted markers %q", markers)
+		}
+	}
+}
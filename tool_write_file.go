@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 )
 
@@ -8,6 +9,7 @@ func registerWriteFileTool(a *Agent) {
 	a.tools["write_file"] = Tool{
 		Name:        "write_file",
 		Description: "Replace a files contents",
+		Writes:      true,
 		InputSchema: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -22,14 +24,20 @@ func registerWriteFileTool(a *Agent) {
 			},
 		},
 		Execute: func(input map[string]interface{}) (string, error) {
-			path := input["path"].(string)
-			content := input["content"].(string)
+			path, ok := input["path"].(string)
+			if !ok {
+				return "", fmt.Errorf("path is required")
+			}
+			content, ok := input["content"].(string)
+			if !ok {
+				return "", fmt.Errorf("content is required")
+			}
 
-			if !isPathSafe(path) {
+			if !a.isPathSafe(path) {
 				return "", os.ErrPermission
 			}
 
-			err := writeWithConfirmation(path, []byte(content), a.yolo)
+			err := writeWithConfirmation(path, []byte(content), a.writeOptions())
 			if err != nil {
 				return "", err
 			}
@@ -1,12 +1,311 @@
 package main
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
 // registerTools sets up the available tools for the agent
 func (a *Agent) registerTools() {
 	registerSearchReplaceTool(a)
+	registerEditLinesTool(a)
+	registerInsertLinesTool(a)
 	registerListFilesTool(a)
 	registerReadFileTool(a)
+	registerReadFilesTool(a)
 	registerWriteFileTool(a)
 	registerRipgrepTool(a)
 	registerGoDocTool(a)
 	registerGoVetTool(a)
+	registerGoCoverTool(a)
+	registerGoTestTool(a)
+	registerGoAPITool(a)
+	registerGolangciLintTool(a)
+	registerGoModTool(a)
+	registerGoDefinitionTool(a)
+	registerGoHoverTool(a)
+	registerGoDiagnosticsTool(a)
+	registerEnvVarsTool(a)
+	registerSecretScanTool(a)
+	registerTodoCommentsTool(a)
+	registerCodeStatsTool(a)
+	registerRangeCopyAuditTool(a)
+	registerAllocAuditTool(a)
+	registerToBuilderTool(a)
+	registerFindPanicsTool(a)
+	registerPanicToErrorTool(a)
+	registerDocConsistencyTool(a)
+	registerDeprecatedUsagesTool(a)
+	registerGitDiffTool(a)
+	registerGitCommitTool(a)
+	registerGitLogTool(a)
+	registerGitBlameTool(a)
+}
+
+// selectTools unregisters the tools the user turned off, so the model never
+// sees them. With enable, only the named tools stay; disable removes tools
+// either way. Both take tool names, entries may be comma separated.
+func (a *Agent) selectTools(enable, disable []string) error {
+	names := func(entries []string) (map[string]bool, error) {
+		set := make(map[string]bool)
+		for _, entry := range entries {
+			for _, name := range strings.Split(entry, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				if _, ok := a.tools[name]; !ok {
+					return nil, fmt.Errorf("unknown tool %q", name)
+				}
+				set[name] = true
+			}
+		}
+		return set, nil
+	}
+	enabled, err := names(enable)
+	if err != nil {
+		return err
+	}
+	disabled, err := names(disable)
+	if err != nil {
+		return err
+	}
+
+	for name := range a.tools {
+		if (len(enabled) > 0 && !enabled[name]) || disabled[name] {
+			delete(a.tools, name)
+		}
+	}
+	return nil
+}
+
+// makeReadOnly unregisters every tool that modifies files, regardless of
+// --enable. Tools that write only when asked to stay, without the input
+// that asks for it.
+func (a *Agent) makeReadOnly() {
+	for name, tool := range a.tools {
+		if !tool.Writes {
+			continue
+		}
+		if tool.WriteInput == "" {
+			delete(a.tools, name)
+			continue
+		}
+
+		// Hide the input from the model and refuse it anyway
+		schema := make(map[string]interface{})
+		for key, value := range tool.InputSchema {
+			schema[key] = value
+		}
+		properties := make(map[string]interface{})
+		if original, ok := tool.InputSchema["properties"].(map[string]interface{}); ok {
+			for key, value := range original {
+				if key != tool.WriteInput {
+					properties[key] = value
+				}
+			}
+		}
+		schema["properties"] = properties
+		tool.InputSchema = schema
+
+		writeInput, execute := tool.WriteInput, tool.Execute
+		tool.Execute = func(input map[string]interface{}) (string, error) {
+			if write, _ := input[writeInput].(bool); write {
+				return "", fmt.Errorf("%s is not available in read-only mode", writeInput)
+			}
+			return execute(input)
+		}
+		tool.Writes = false
+		a.tools[name] = tool
+	}
+}
+
+// toolFailedPrefix starts the results of tools that failed
+const toolFailedPrefix = "tool execution failed: "
+
+// executeTool runs a registered tool, rendering the call. Failures of the tool
+// itself are returned as the result so the model can react to them; only an
+// unknown tool is an error.
+func (a *Agent) executeTool(name string, input map[string]interface{}) (string, error) {
+	tool, ok := a.tools[name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+
+	a.output.ToolCall(name, input)
+
+	result, toolErr := "", validateInput(tool.InputSchema, input)
+	if toolErr == nil {
+		result, toolErr = a.runTool(tool, input)
+	}
+	if errors.Is(toolErr, errChangeRejected) {
+		// Not a failure, the model should know and carry on
+		result, toolErr = "change rejected by user, the file was not modified", nil
+		a.output.Notice("change rejected")
+	} else if toolErr != nil {
+		a.output.ToolError(name, toolErr)
+		result = fmt.Sprintf("%sError: %v", toolFailedPrefix, toolErr)
+	} else {
+		a.output.ToolResult(name, result)
+	}
+
+	// The result is shown as is but sent, and logged, with secrets masked
+	if a.redact {
+		result = redactSecrets(result)
+	}
+
+	// Keep gopls' view of the files it has open current after edits
+	if tool.writesFor(input) && a.gopls != nil {
+		a.gopls.resync()
+	}
+
+	if a.audit != nil {
+		if err := a.audit.record(name, input, result, toolErr); err != nil {
+			a.output.Notice(fmt.Sprintf("failed to write audit log: %v", err))
+		}
+	}
+
+	return result, nil
+}
+
+// callTool executes the tool, turning a panic into an error so a bad call
+// can't take the agent or the MCP server down
+func callTool(tool Tool, input map[string]interface{}) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = "", fmt.Errorf("%s panicked: %v", tool.Name, r)
+		}
+	}()
+	return tool.Execute(input)
+}
+
+// validateInput checks that the required inputs of a tool's schema are
+// present and that the inputs given have the declared JSON types
+func validateInput(schema map[string]interface{}, input map[string]interface{}) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+	var required []string
+	switch r := schema["required"].(type) {
+	case []string:
+		required = r
+	case []interface{}:
+		for _, name := range r {
+			if name, ok := name.(string); ok {
+				required = append(required, name)
+			}
+		}
+	}
+	for _, name := range required {
+		if value, ok := input[name]; !ok || value == nil {
+			return fmt.Errorf("missing required input %q", name)
+		}
+	}
+
+	for name, value := range input {
+		property, _ := properties[name].(map[string]interface{})
+		if property == nil || value == nil {
+			continue
+		}
+		// A type is a name or a list of names, like ["string", "array"]
+		var types []string
+		switch t := property["type"].(type) {
+		case string:
+			types = []string{t}
+		case []string:
+			types = t
+		case []interface{}:
+			for _, typ := range t {
+				if typ, ok := typ.(string); ok {
+					types = append(types, typ)
+				}
+			}
+		}
+		if len(types) == 0 {
+			continue
+		}
+		matched := false
+		for _, typ := range types {
+			if hasJSONType(value, typ) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("input %q must be of type %s", name, strings.Join(types, " or "))
+		}
+	}
+	return nil
+}
+
+// hasJSONType reports whether a decoded JSON value has the JSON schema type
+func hasJSONType(value interface{}, typ string) bool {
+	switch v := value.(type) {
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case float64:
+		return typ == "number" || (typ == "integer" && v == math.Trunc(v))
+	case int, int64:
+		return typ == "number" || typ == "integer"
+	case []interface{}:
+		return typ == "array"
+	case map[string]interface{}:
+		return typ == "object"
+	}
+	return false
+}
+
+// runTool applies dry run mode and the tool's policy, then executes it.
+// Calls that don't run return a result telling the model why.
+func (a *Agent) runTool(tool Tool, input map[string]interface{}) (string, error) {
+	writes := tool.writesFor(input)
+	if a.dryRun && (writes || !a.dryRunReads) {
+		a.output.Notice(fmt.Sprintf("dry run: %s not executed", tool.Name))
+		return "dry run: not executed", nil
+	}
+
+	policy := a.toolPolicy(tool.Name)
+	a.activePolicy = policy
+	defer func() { a.activePolicy = "" }()
+	switch {
+	case policy == policyDeny:
+		return "", fmt.Errorf("denied by tool policy, the user's policy doesn't allow %s", tool.Name)
+	case policy == policyConfirm && !writes:
+		// Writing tools ask before they write instead, which the policy
+		// applies to
+		if !confirm(fmt.Sprintf("Run %s?", tool.Name)) {
+			return "tool execution rejected by the user", nil
+		}
+	}
+
+	// Writing tools may show a diff and ask for confirmation, which the
+	// spinner would draw over
+	if !writes {
+		stop := a.output.Working(tool.Name)
+		defer stop()
+	}
+
+	// With --goimports, Go files the tool changed are fixed up and the model
+	// is told about it
+	goFile := a.editedGoFile(tool, input)
+	var before []byte
+	if goFile != "" {
+		before, _ = os.ReadFile(goFile)
+	}
+	result, err := callTool(tool, input)
+	if err != nil || goFile == "" {
+		return result, err
+	}
+	if after, readErr := os.ReadFile(goFile); readErr != nil || bytes.Equal(before, after) {
+		return result, err
+	}
+	if note := goimportsCheck(goFile); note != "" {
+		a.output.Notice(note)
+		result += "\n\n" + note
+	}
+	return result, nil
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"os"
 	"path/filepath"
 	"strings"
 )
@@ -12,45 +11,113 @@ type Tool struct {
 	Description string
 	InputSchema map[string]interface{}
 	Execute     func(input map[string]interface{}) (string, error)
+	// Writes marks tools that may modify files. Unless writes apply
+	// automatically, they ask the user before writing, through the diff of
+	// writeWithConfirmation or a question of their own.
+	Writes bool
+	// WriteInput names the boolean input that makes a writing tool modify
+	// files, for tools that only read without it. Read-only mode keeps them
+	// without that input.
+	WriteInput string
 }
 
-// isPathSafe checks if a path is within the current working directory and not a dotfile
-func isPathSafe(path string) bool {
-	// Get absolute path
-	absPath, err := filepath.Abs(path)
-	if err != nil {
+// writesFor reports whether a call of the tool with input may modify files
+func (t Tool) writesFor(input map[string]interface{}) bool {
+	if !t.Writes {
 		return false
 	}
+	if t.WriteInput == "" {
+		return true
+	}
+	write, _ := input[t.WriteInput].(bool)
+	return write
+}
+
+// isPathSafe checks if a path is within the agent's working directory or one of
+// the additionally allowed directories, and not a dotfile unless dotfiles are allowed
+func (a *Agent) isPathSafe(path string) bool {
+	if isPathUnder(path, a.dir, a.allowDotfiles) {
+		return true
+	}
+	for _, dir := range a.allowDirs {
+		if isPathUnder(path, dir, a.allowDotfiles) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPackagePathSafe checks a Go package pattern like ./pkg/... the same way
+// as isPathSafe, the "..." wildcard isn't a dotfile
+func (a *Agent) isPackagePathSafe(pattern string) bool {
+	if pattern == "..." {
+		pattern = "."
+	}
+	return a.isPathSafe(strings.TrimSuffix(pattern, "/..."))
+}
 
-	// Get current working directory
-	cwd, err := os.Getwd()
+// isPathUnder checks if a path is within root and, unless allowDotfiles is
+// set, has no dotfile components below root
+func isPathUnder(path, root string, allowDotfiles bool) bool {
+	// Get absolute path
+	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return false
 	}
 
-	// Clean and normalize paths
-	absPath = filepath.Clean(absPath)
-	cwd = filepath.Clean(cwd)
+	// Clean and normalize paths, following symlinks so a link inside root
+	// can't point outside of it
+	absPath = resolveSymlinks(filepath.Clean(absPath))
+	root = resolveSymlinks(filepath.Clean(root))
 
-	// Only check components under cwd for dots
-	relPath, err := filepath.Rel(cwd, absPath)
+	// Only check components under root for dots
+	relPath, err := filepath.Rel(root, absPath)
 	if err != nil {
 		return false
 	}
 	
-	// Allow if path is exactly cwd
+	// Allow if path is exactly root
 	if relPath == "." {
 		return true
 	}
+
+	// Reject paths that leave root
+	if relPath == ".." || strings.HasPrefix(filepath.ToSlash(relPath), "../") {
+		return false
+	}
 	
-	// Check if any component under cwd starts with a dot
-	pathParts := strings.Split(filepath.ToSlash(relPath), "/")
-	for _, part := range pathParts {
-		if strings.HasPrefix(part, ".") {
-			return false
+	// Check if any component under root starts with a dot
+	if !allowDotfiles {
+		pathParts := strings.Split(filepath.ToSlash(relPath), "/")
+		for _, part := range pathParts {
+			if strings.HasPrefix(part, ".") {
+				return false
+			}
 		}
 	}
 
-	// Check if path is within cwd
-	return strings.HasPrefix(absPath, cwd)
-}
\ No newline at end of file
+	// Check if path is within root
+	return strings.HasPrefix(absPath, root)
+}
+
+// resolveSymlinks returns the real path of an absolute path. Paths that don't
+// exist yet, e.g. files about to be written, are resolved through their
+// deepest existing ancestor.
+func resolveSymlinks(absPath string) string {
+	var missing []string
+	current := absPath
+	for {
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return absPath
+		}
+		missing = append(missing, filepath.Base(current))
+		current = parent
+	}
+}
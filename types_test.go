@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPathSafeSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("hunter2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"out":    outside,
+		"passwd": filepath.Join(outside, "secret"),
+		"inside": filepath.Join(root, "pkg"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks aren't supported: %v", err)
+		}
+	}
+
+	a := &Agent{dir: root}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"pkg/main.go", true},
+		{"inside/main.go", true},
+		{"passwd", false},
+		{"out", false},
+		{"out/secret", false},
+		// Files about to be written don't exist yet
+		{"out/new.go", false},
+		{"out/new/dir/new.go", false},
+		{"pkg/new/dir/new.go", true},
+	}
+	for _, tt := range tests {
+		if got := a.isPathSafe(filepath.Join(root, tt.path)); got != tt.want {
+			t.Errorf("isPathSafe(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}